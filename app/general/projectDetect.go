@@ -33,7 +33,7 @@ func FindPlannableProjects(baseDir string, pattern string) ([]string, error) {
 		} else if matched {
 			relFile, err := filepath.Rel(baseDir, path)
 			if err != nil {
-				panic(err)
+				return err
 			}
 			projectPlanDir := (baseDir + "/" + filepath.Dir(relFile))
 
@@ -69,11 +69,11 @@ func contains(projects []string, projectDir string) bool {
 	return false
 }
 
-func GetPlannableProjects(workingPath string) ([]string, bool) {
+func GetPlannableProjects(workingPath string) ([]string, bool, error) {
 	// Setup projects to plan
 	projects, err := FindPlannableProjects(workingPath, "*.tf")
 	if err != nil {
-		panic(err)
+		return nil, false, err
 	}
 
 	// Check to see if projects list is more than 0, to determine if plannable
@@ -85,5 +85,5 @@ func GetPlannableProjects(workingPath string) ([]string, bool) {
 		isPlannable = true
 	}
 
-	return projects, isPlannable
+	return projects, isPlannable, nil
 }
@@ -0,0 +1,284 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// Drift severity a project must reach to raise an alert.
+const (
+	// Any planned change.
+	AlertOnDrift = "drift"
+	// A resource destroyed or replaced.
+	AlertOnDestroy = "destroy"
+)
+
+// Default prefix of alert dedup keys.
+const DefaultAlertKeyPrefix = "tfdrift"
+
+// Dedup keys longer than this are hashed, PagerDuty accepts 255 characters.
+const maxAlertKeyLength = 255
+
+// Resources listed in an alert's details, the rest are counted.
+const maxAlertResources = 25
+
+// Attempts per alert event when the service answers 429 or 5xx.
+const alertAttempts = 3
+
+// Longest Retry-After honoured between two attempts.
+const maxAlertRetryAfter = time.Minute
+
+// Parse an --alert-on value.
+func ParseAlertSeverity(value string) (string, error) {
+	switch value {
+	case AlertOnDrift, AlertOnDestroy:
+		return value, nil
+	}
+	return "", fmt.Errorf("--alert-on %q not supported (%s, %s)", value, AlertOnDrift, AlertOnDestroy)
+}
+
+// Whether a project reaches the severity.
+func alertRaised(service *terraform.TerraformService, severity string) bool {
+	if service.Status != terraform.StatusDrift {
+		return false
+	}
+	return severity == AlertOnDrift || service.CountDestroy > 0
+}
+
+// Projects whose alert is triggered and projects whose alert is resolved. Failed projects are in
+// neither, their drift is unknown so an open alert stays open.
+func alertProjects(report *terraform.ScanReport, severity string) (trigger []*terraform.TerraformService, resolve []*terraform.TerraformService) {
+	for _, service := range report.Projects {
+		switch {
+		case service.Status.Failed():
+			log.Debugf("[alertProjects] %s failed, leaving its alert unchanged", service.ProjectPath)
+		case alertRaised(service, severity):
+			trigger = append(trigger, service)
+		default:
+			resolve = append(resolve, service)
+		}
+	}
+	return trigger, resolve
+}
+
+// Alert keys raised by earlier scans, kept in a JSON file per notifier name, e.g.
+// {"pagerduty": ["tfdrift:stacks/app"]}, so a scan only resolves the alerts that are open instead of
+// sending a resolve event for every clean project. Shared by the alert notifiers of a scan.
+type AlertState struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Keys left open for the notifier name. ok is false when the file does not exist yet, the first scan
+// then resolves every project below the severity as it would without a state.
+func (s *AlertState) Open(name string) (keys map[string]bool, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]bool), false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	keys = make(map[string]bool)
+	for _, key := range state[name] {
+		keys[key] = true
+	}
+	return keys, true, nil
+}
+
+// Record the keys left open for the notifier name, keeping the other notifiers' keys.
+func (s *AlertState) Save(name string, keys map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if errors.Is(err, os.ErrNotExist) {
+		state, err = make(map[string][]string), nil
+	}
+	if err != nil {
+		return err
+	}
+	state[name] = []string{}
+	for key := range keys {
+		state[name] = append(state[name], key)
+	}
+	sort.Strings(state[name])
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(s.Path, append(data, '\n'), 0o644)
+}
+
+func (s *AlertState) read() (map[string][]string, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[string][]string)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("alert state %s: %w", s.Path, err)
+	}
+	return state, nil
+}
+
+// Raise the alert of every project reaching the severity and resolve the alert of the other projects,
+// through the notifier name's raise and resolve requests. With a state, only alerts an earlier scan
+// raised are resolved and the state is updated; an alert whose request failed stays recorded as open,
+// so a later scan resolves it.
+func syncAlerts(name string, report *terraform.ScanReport, severity string, keyPrefix string, state *AlertState,
+	raise func(service *terraform.TerraformService, key string) error, resolve func(key string) error) error {
+	trigger, clean := alertProjects(report, severity)
+	open, known := make(map[string]bool), false
+	if state != nil {
+		var err error
+		if open, known, err = state.Open(name); err != nil {
+			return err
+		}
+	}
+
+	var firstErr error
+	for _, service := range trigger {
+		key := AlertKey(keyPrefix, report, service)
+		open[key] = true
+		if err := raise(service, key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	resolved := 0
+	for _, service := range clean {
+		key := AlertKey(keyPrefix, report, service)
+		if known && !open[key] {
+			continue
+		}
+		if err := resolve(key); err != nil {
+			open[key] = true
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(open, key)
+		resolved++
+	}
+	log.Debugf("[syncAlerts] %s: raised %d and resolved %d alerts, %d clean projects had none open",
+		name, len(trigger), resolved, len(clean)-resolved)
+
+	if state != nil {
+		if err := state.Save(name, open); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stable identifier of a project's alert across scans: the prefix and the project path relative to the
+// scan root, hashed when too long.
+func AlertKey(prefix string, report *terraform.ScanReport, service *terraform.TerraformService) string {
+	key := prefix + ":" + terraform.DisplayPath(report.RootPath, service)
+	if len(key) > maxAlertKeyLength {
+		sum := sha256.Sum256([]byte(key))
+		key = prefix + ":" + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+// One line description of a project's drift.
+func alertSummary(report *terraform.ScanReport, service *terraform.TerraformService) string {
+	summary := fmt.Sprintf("Terraform drift in %s: %d to add, %d to change, %d to destroy",
+		terraform.DisplayPath(report.RootPath, service), service.CountAdd, service.CountChange, service.CountDestroy)
+	if service.CountOutside > 0 {
+		summary += fmt.Sprintf(", %d changed outside Terraform", service.CountOutside)
+	}
+	return summary
+}
+
+// Details attached to an alert.
+func alertDetails(report *terraform.ScanReport, service *terraform.TerraformService, reportURL string) map[string]interface{} {
+	var resources []string
+	for i, res := range service.Resources {
+		if i == maxAlertResources {
+			resources = append(resources, fmt.Sprintf("…and %d more", len(service.Resources)-i))
+			break
+		}
+		resources = append(resources, fmt.Sprintf("%s %s", res.Action, res.Address))
+	}
+	details := map[string]interface{}{
+		"project":           terraform.DisplayPath(report.RootPath, service),
+		"root_path":         report.RootPath,
+		"mode":              service.Mode,
+		"terraform_version": service.TerraformVersion,
+		"add":               service.CountAdd,
+		"change":            service.CountChange,
+		"destroy":           service.CountDestroy,
+		"changed_outside":   service.CountOutside,
+		"resources":         strings.Join(resources, "\n"),
+	}
+	if reportURL != "" {
+		details["report_url"] = reportURL
+	}
+	return details
+}
+
+// POST an alert event, retrying rate limits and server errors.
+func postAlert(ctx context.Context, url string, headers map[string]string, event interface{}) error {
+	wait := time.Second
+	for attempt := 1; ; attempt++ {
+		resp, body, err := postJSON(ctx, url, headers, event)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+		if !retry || attempt == alertAttempts {
+			return responseError(resp, body)
+		}
+		delay := wait
+		if retryAfter := alertRetryAfter(resp); retryAfter > delay {
+			delay = retryAfter
+		}
+		log.Debugf("[postAlert] %s, retrying in %s", resp.Status, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		wait *= 2
+	}
+}
+
+// Wait asked for by a Retry-After header in seconds, at most maxAlertRetryAfter, 0 without one.
+func alertRetryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	if delay := time.Duration(seconds * float64(time.Second)); delay < maxAlertRetryAfter {
+		return delay
+	}
+	return maxAlertRetryAfter
+}
@@ -0,0 +1,254 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tfdrift/app/terraform"
+)
+
+// Refresh-only scan of /infra whose only project has an object deleted outside of Terraform.
+func testRefreshOnlyReport() *terraform.ScanReport {
+	service := terraform.NewProjectService("/infra/stacks/app")
+	service.Mode = terraform.ModeRefreshOnly
+	service.SetStatus(terraform.StatusDrift)
+	deleted := []terraform.ResourceDrift{{Address: "aws_instance.gone", Action: terraform.ActionDelete}}
+	service.SetResources(deleted)
+	service.SetOutsideChanges(deleted)
+	return terraform.NewScanReport("/infra", "test", terraform.ModeRefreshOnly, time.Now(), time.Now(), []*terraform.TerraformService{service})
+}
+
+func TestAlertChangesOutsideTerraform(t *testing.T) {
+	report := testRefreshOnlyReport()
+	service := report.Projects[0]
+	// Deleted outside of Terraform is not a planned destroy
+	if alertRaised(service, AlertOnDestroy) {
+		t.Error("alertRaised(destroy) for an object deleted outside of Terraform")
+	}
+	if !alertRaised(service, AlertOnDrift) {
+		t.Error("alertRaised(drift) = false for a drifted project")
+	}
+	p := &PagerDutyNotifier{RoutingKey: "key", KeyPrefix: DefaultAlertKeyPrefix}
+	payload := p.triggerEvent(report, service)["payload"].(map[string]interface{})
+	if payload["severity"] != "warning" {
+		t.Errorf("PagerDuty severity %v, want warning", payload["severity"])
+	}
+	if summary := alertSummary(report, service); !strings.HasSuffix(summary, "0 to destroy, 1 changed outside Terraform") {
+		t.Errorf("alertSummary() = %q", summary)
+	}
+}
+
+// Scan of /infra where the listed projects destroy a resource and the others are clean.
+func testAlertReport(destroyed ...string) *terraform.ScanReport {
+	var services []*terraform.TerraformService
+	for _, project := range []string{"stacks/app", "stacks/db", "stacks/dns"} {
+		service := terraform.NewProjectService("/infra/" + project)
+		service.SetStatus(terraform.StatusNoDrift)
+		for _, name := range destroyed {
+			if name == project {
+				service.SetStatus(terraform.StatusDrift)
+				service.SetResources([]terraform.ResourceDrift{{Address: "aws_instance.web", Action: terraform.ActionReplace}})
+			}
+		}
+		services = append(services, service)
+	}
+	return terraform.NewScanReport("/infra", "test", terraform.ModeFull, time.Now(), time.Now(), services)
+}
+
+// Stand-in PagerDuty Events API recording "action dedup_key" of every event.
+type pagerDutyServer struct {
+	mu     sync.Mutex
+	events []string
+	// Answer events for this key with 400.
+	fail string
+}
+
+func (s *pagerDutyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var event struct {
+		Action string `json:"event_action"`
+		Key    string `json:"dedup_key"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	json.Unmarshal(body, &event)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event.Action+" "+event.Key)
+	if event.Key == s.fail {
+		http.Error(w, `{"status": "invalid event"}`, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *pagerDutyServer) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func TestAlertStateResolvesOnlyOpenAlerts(t *testing.T) {
+	s := &pagerDutyServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	state := &AlertState{Path: filepath.Join(t.TempDir(), "state", "alerts.json")}
+	notifier := &PagerDutyNotifier{RoutingKey: "key", Severity: AlertOnDestroy, KeyPrefix: "tfdrift", URL: server.URL, State: state}
+
+	scans := []struct {
+		name       string
+		report     *terraform.ScanReport
+		fail       string
+		wantEvents []string
+		wantOpen   []string
+	}{
+		{
+			// No state yet: alerts opened before the state file existed are resolved too
+			name:       "first scan",
+			report:     testAlertReport("stacks/app"),
+			wantEvents: []string{"trigger tfdrift:stacks/app", "resolve tfdrift:stacks/db", "resolve tfdrift:stacks/dns"},
+			wantOpen:   []string{"tfdrift:stacks/app"},
+		},
+		{
+			name:       "drift remains",
+			report:     testAlertReport("stacks/app"),
+			wantEvents: []string{"trigger tfdrift:stacks/app"},
+			wantOpen:   []string{"tfdrift:stacks/app"},
+		},
+		{
+			name:       "clean scan",
+			report:     testAlertReport(),
+			wantEvents: []string{"resolve tfdrift:stacks/app"},
+			wantOpen:   []string{},
+		},
+		{
+			name:       "nothing open",
+			report:     testAlertReport(),
+			wantEvents: nil,
+			wantOpen:   []string{},
+		},
+		{
+			name:       "new drift",
+			report:     testAlertReport("stacks/db", "stacks/dns"),
+			wantEvents: []string{"trigger tfdrift:stacks/db", "trigger tfdrift:stacks/dns"},
+			wantOpen:   []string{"tfdrift:stacks/db", "tfdrift:stacks/dns"},
+		},
+		{
+			// A failed resolve is retried by the next scan
+			name:       "resolve fails",
+			report:     testAlertReport(),
+			fail:       "tfdrift:stacks/db",
+			wantEvents: []string{"resolve tfdrift:stacks/db", "resolve tfdrift:stacks/dns"},
+			wantOpen:   []string{"tfdrift:stacks/db"},
+		},
+		{
+			name:       "resolve retried",
+			report:     testAlertReport(),
+			wantEvents: []string{"resolve tfdrift:stacks/db"},
+			wantOpen:   []string{},
+		},
+	}
+	for _, scan := range scans {
+		s.fail = scan.fail
+		err := notifier.Notify(context.Background(), scan.report)
+		if (err != nil) != (scan.fail != "") {
+			t.Errorf("%s: Notify() = %v", scan.name, err)
+		}
+		if events := s.take(); !reflect.DeepEqual(events, scan.wantEvents) {
+			t.Errorf("%s: events %q, want %q", scan.name, events, scan.wantEvents)
+		}
+		data, err := os.ReadFile(state.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved map[string][]string
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(saved["pagerduty"], scan.wantOpen) {
+			t.Errorf("%s: state %s, want %q open", scan.name, data, scan.wantOpen)
+		}
+	}
+}
+
+func TestAlertStateKeepsOtherNotifiers(t *testing.T) {
+	state := &AlertState{Path: filepath.Join(t.TempDir(), "alerts.json")}
+	if err := state.Save("opsgenie", map[string]bool{"tfdrift:stacks/app": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save("pagerduty", map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	keys, ok, err := state.Open("opsgenie")
+	if err != nil || !ok || !reflect.DeepEqual(keys, map[string]bool{"tfdrift:stacks/app": true}) {
+		t.Errorf("Open(opsgenie) = %v, %t, %v", keys, ok, err)
+	}
+	if keys, ok, err := state.Open("pagerduty"); err != nil || !ok || len(keys) != 0 {
+		t.Errorf("Open(pagerduty) = %v, %t, %v", keys, ok, err)
+	}
+
+	if err := os.WriteFile(state.Path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A damaged state is reported rather than overwritten
+	if _, _, err := state.Open("opsgenie"); err == nil {
+		t.Error("Open() accepted an invalid state file")
+	}
+}
+
+func TestAlertRetryAfter(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"":        0,
+		"2":       2 * time.Second,
+		"0.5":     500 * time.Millisecond,
+		"3600":    maxAlertRetryAfter,
+		"-1":      0,
+		"Wed, 21": 0,
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if header != "" {
+			resp.Header.Set("Retry-After", header)
+		}
+		if got := alertRetryAfter(resp); got != want {
+			t.Errorf("alertRetryAfter(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestPostAlertRetries(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+	if err := postAlert(context.Background(), server.URL, nil, map[string]string{}); err != nil || requests != 2 {
+		t.Errorf("postAlert() = %v after %d requests, want success after 2", err, requests)
+	}
+
+	requests = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, fmt.Sprintf(`{"message": "request %d invalid"}`, requests), http.StatusBadRequest)
+	})
+	if err := postAlert(context.Background(), server.URL, nil, map[string]string{}); err == nil || requests != 1 {
+		t.Errorf("postAlert() = %v after %d requests, want an error without retry", err, requests)
+	}
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"tfdrift/log"
+)
+
+// Where GitHub and GitLab look for CODEOWNERS, relative to the repository root.
+var codeOwnersLocations = []string{".github/CODEOWNERS", ".gitlab/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Ownership rules of a CODEOWNERS file. Later rules take precedence, as on GitHub and GitLab.
+type CodeOwners struct {
+	// Repository root the patterns are relative to.
+	Root  string
+	rules []codeOwnersRule
+}
+
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// Find the CODEOWNERS file of the repository containing dir. Returns an empty path when there is none.
+func FindCodeOwners(dir string) (path string, root string) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", ""
+	}
+	for {
+		for _, location := range codeOwnersLocations {
+			candidate := filepath.Join(dir, filepath.FromSlash(location))
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate, dir
+			}
+		}
+		// Stop at the repository root
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// Parse a CODEOWNERS file whose patterns are relative to root. GitLab sections are read as plain rules.
+func LoadCodeOwners(path string, root string) (*CodeOwners, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	codeOwners := &CodeOwners{Root: root}
+	scanner := bufio.NewScanner(f)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		// Comments, blank lines and GitLab section headers ([Section] or ^[Optional section])
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		fields := strings.Fields(line)
+		pattern, err := codeOwnersPattern(fields[0])
+		if err != nil {
+			log.Printf("[LoadCodeOwners] Skipping %s:%d: %s", path, number, err)
+			continue
+		}
+		rule := codeOwnersRule{pattern: pattern}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break
+			}
+			rule.owners = append(rule.owners, owner)
+		}
+		codeOwners.rules = append(codeOwners.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	log.Debugf("[LoadCodeOwners] Loaded %d rules from %s", len(codeOwners.rules), path)
+	return codeOwners, nil
+}
+
+// Owners of a file or directory, given relative to Root with forward slashes.
+func (c *CodeOwners) Owners(path string) []string {
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// Owners of a project: everyone owning one of its Terraform files, or the directory itself when it has none.
+func (c *CodeOwners) ProjectOwners(projectDir string) []string {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(c.Root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.tf"))
+	paths := []string{rel}
+	if len(files) > 0 {
+		paths = nil
+		for _, file := range files {
+			paths = append(paths, strings.TrimPrefix(rel+"/"+filepath.Base(file), "./"))
+		}
+	}
+
+	var owners []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		for _, owner := range c.Owners(path) {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// Translate a CODEOWNERS (gitignore style) pattern into a regular expression matching the paths it
+// owns, including everything below a matched directory.
+func codeOwnersPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") {
+		return nil, fmt.Errorf("negated pattern %q not supported", pattern)
+	}
+	// A slash anywhere but at the end anchors the pattern to the root
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	directory := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	switch {
+	case directory:
+		b.WriteString("/.*$")
+	case strings.HasSuffix(pattern, "/*"):
+		// docs/* owns the files in docs, not those in its subdirectories
+		b.WriteString("$")
+	default:
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
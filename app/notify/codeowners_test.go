@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCodeOwnersPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "*",
+			match:   []string{"main.tf", "stacks/network/main.tf"},
+		},
+		{
+			pattern: "*.tf",
+			match:   []string{"main.tf", "stacks/network/main.tf"},
+			noMatch: []string{"main.tfvars", "README.md"},
+		},
+		{
+			// No slash: matches a file or directory of that name at any depth
+			pattern: "network",
+			match:   []string{"network", "network/main.tf", "stacks/network/main.tf"},
+			noMatch: []string{"networking/main.tf", "stacks/network-shared/main.tf"},
+		},
+		{
+			// Trailing slash: a directory at any depth and everything below it
+			pattern: "modules/",
+			match:   []string{"modules/vpc/main.tf", "stacks/modules/main.tf"},
+			noMatch: []string{"modules", "modules.tf"},
+		},
+		{
+			// Leading slash: anchored to the root
+			pattern: "/stacks/",
+			match:   []string{"stacks/main.tf", "stacks/network/main.tf"},
+			noMatch: []string{"live/stacks/main.tf"},
+		},
+		{
+			// A slash in the middle anchors as well
+			pattern: "stacks/network",
+			match:   []string{"stacks/network", "stacks/network/main.tf", "stacks/network/sub/main.tf"},
+			noMatch: []string{"live/stacks/network/main.tf", "stacks/network2/main.tf"},
+		},
+		{
+			// dir/* owns the files directly in dir only
+			pattern: "docs/*",
+			match:   []string{"docs/README.md"},
+			noMatch: []string{"docs/build/README.md", "docs", "live/docs/README.md"},
+		},
+		{
+			pattern: "**/prod",
+			match:   []string{"prod/main.tf", "stacks/prod/main.tf", "a/b/c/prod/main.tf"},
+			noMatch: []string{"production/main.tf"},
+		},
+		{
+			pattern: "stacks/**/main.tf",
+			match:   []string{"stacks/main.tf", "stacks/network/main.tf", "stacks/a/b/main.tf"},
+			noMatch: []string{"stacks/network/outputs.tf", "live/stacks/main.tf"},
+		},
+		{
+			pattern: "/stacks/**",
+			match:   []string{"stacks/main.tf", "stacks/a/b/main.tf"},
+			noMatch: []string{"live/stacks/main.tf"},
+		},
+		{
+			pattern: "stack-?/",
+			match:   []string{"stack-a/main.tf", "live/stack-b/main.tf"},
+			noMatch: []string{"stack-ab/main.tf", "stack-/main.tf"},
+		},
+		{
+			// Regular expression characters are literal
+			pattern: "/envs/prod.eu+1/",
+			match:   []string{"envs/prod.eu+1/main.tf"},
+			noMatch: []string{"envs/prodXeu1/main.tf", "envs/prod.euu1/main.tf"},
+		},
+		{
+			pattern: `/with\ space/`,
+			match:   []string{"with space/main.tf"},
+		},
+		{
+			pattern: "/räume/",
+			match:   []string{"räume/main.tf"},
+			noMatch: []string{"raume/main.tf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := codeOwnersPattern(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range tt.match {
+				if !re.MatchString(path) {
+					t.Errorf("%q (%s) does not match %q", tt.pattern, re, path)
+				}
+			}
+			for _, path := range tt.noMatch {
+				if re.MatchString(path) {
+					t.Errorf("%q (%s) matches %q", tt.pattern, re, path)
+				}
+			}
+		})
+	}
+}
+
+func TestCodeOwnersPatternNegation(t *testing.T) {
+	if _, err := codeOwnersPattern("!stacks/"); err == nil {
+		t.Error("negated pattern accepted")
+	}
+}
+
+func TestProjectOwners(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".github/CODEOWNERS": `# Default owners
+* @acme/platform
+
+[Network]
+/stacks/network/ @alice @acme/network # trailing comment
+/stacks/network/dns.tf @bob
+/stacks/legacy/
+*.md @docs
+`,
+		"stacks/network/main.tf":   "",
+		"stacks/network/dns.tf":    "",
+		"stacks/network/README.md": "",
+		"stacks/legacy/main.tf":    "",
+		"stacks/app/main.tf":       "",
+		".git/HEAD":                "",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, repoRoot := FindCodeOwners(filepath.Join(root, "stacks", "network"))
+	if path != filepath.Join(root, ".github", "CODEOWNERS") || repoRoot != root {
+		t.Fatalf("FindCodeOwners() = %s, %s", path, repoRoot)
+	}
+	codeOwners, err := LoadCodeOwners(path, repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		project string
+		want    []string
+	}{
+		// Owners of every .tf file, in file order: dns.tf is owned by @bob, main.tf by the network rule
+		{project: "stacks/network", want: []string{"@bob", "@alice", "@acme/network"}},
+		// A rule without owners removes ownership
+		{project: "stacks/legacy", want: nil},
+		{project: "stacks/app", want: []string{"@acme/platform"}},
+		// Not in the repository
+		{project: "../elsewhere", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.project, func(t *testing.T) {
+			got := codeOwners.ProjectOwners(filepath.Join(root, filepath.FromSlash(tt.project)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProjectOwners(%s) = %v, want %v", tt.project, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := issueAssignees(codeOwners.ProjectOwners(filepath.Join(root, "stacks", "network"))), []string{"bob", "alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("issueAssignees() = %v, want %v", got, want)
+	}
+}
+
+func TestFindCodeOwnersStopsAtRepositoryRoot(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "stacks"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Outside the repository, must not be used
+	if err := os.WriteFile(filepath.Join(root, "CODEOWNERS"), []byte("* @outsider\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := FindCodeOwners(filepath.Join(repo, "stacks")); path != "" {
+		t.Errorf("FindCodeOwners() = %s, want none", path)
+	}
+}
@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// Discord message and embed limits.
+const (
+	discordContentLimit     = 2000
+	discordEmbedsPerMessage = 10
+	discordMessageLimit     = 6000
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+)
+
+// Embed colours.
+const (
+	discordColorDrift  = 0xF1961D
+	discordColorFailed = 0xD9534F
+)
+
+// Attempts per message when Discord keeps answering 429 Too Many Requests.
+const discordAttempts = 5
+
+// Posts one embed per drifted project to a Discord webhook, split over as many messages as
+// Discord's limits require.
+type DiscordNotifier struct {
+	WebhookURL string
+	// Link to the report artifact or CI job.
+	ReportURL string
+}
+
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Characters Discord counts towards the 6000 character message limit.
+func (e discordEmbed) size() int {
+	size := len(e.Title) + len(e.Description)
+	for _, field := range e.Fields {
+		size += len(field.Name) + len(field.Value)
+	}
+	return size
+}
+
+func (d *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	messages := DiscordMessages(report, d.ReportURL)
+	for i, message := range messages {
+		if err := d.post(ctx, message); err != nil {
+			return fmt.Errorf("message %d of %d: %w", i+1, len(messages), err)
+		}
+	}
+	return nil
+}
+
+// Post a message, waiting out rate limits.
+func (d *DiscordNotifier) post(ctx context.Context, message discordMessage) error {
+	for attempt := 1; ; attempt++ {
+		resp, body, err := postJSON(ctx, d.WebhookURL, nil, message)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == discordAttempts {
+			return responseError(resp, body)
+		}
+
+		wait := discordRetryAfter(resp, body)
+		log.Debugf("[DiscordNotifier] Rate limited, retrying in %s", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Delay requested by a 429 response: retry_after from the body (seconds, may be fractional),
+// the Retry-After header, or one second.
+func discordRetryAfter(resp *http.Response, body []byte) time.Duration {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &limited) == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+	if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return time.Second
+}
+
+// Messages for a scan: the title and report link, one embed per drifted project and one embed with the
+// failed projects, packed into as few messages as the embed count and size limits allow. The report link
+// is only in the content: Discord merges embeds of a message sharing a url into the first one.
+func DiscordMessages(report *terraform.ScanReport, reportURL string) []discordMessage {
+	content := "**" + Title(report) + "**"
+	if reportURL != "" {
+		content += "\n" + reportURL
+	}
+
+	var embeds []discordEmbed
+	for _, service := range DriftedProjects(report) {
+		var lines []string
+		for _, res := range service.Resources {
+			lines = append(lines, fmt.Sprintf("`%s` %s", res.Action, res.Address))
+		}
+		fields := []discordField{
+			{Name: "Add", Value: strconv.Itoa(service.CountAdd), Inline: true},
+			{Name: "Change", Value: strconv.Itoa(service.CountChange), Inline: true},
+			{Name: "Destroy", Value: strconv.Itoa(service.CountDestroy), Inline: true},
+		}
+		if service.CountOutside > 0 {
+			fields = append(fields, discordField{Name: "Changed outside Terraform", Value: strconv.Itoa(service.CountOutside), Inline: true})
+		}
+		embeds = append(embeds, discordEmbed{
+			Title:       truncate(terraform.DisplayPath(report.RootPath, service), discordTitleLimit),
+			Description: truncateLines(lines, discordDescriptionLimit),
+			Color:       discordColorDrift,
+			Fields:      fields,
+		})
+	}
+	if failed := FailedProjects(report); len(failed) > 0 {
+		var lines []string
+		for _, service := range failed {
+			line := fmt.Sprintf("`%s` %s", terraform.DisplayPath(report.RootPath, service), service.Summary)
+			if service.FailedPhase != "" {
+				line += fmt.Sprintf(" (%s)", service.FailedPhase)
+			}
+			lines = append(lines, line)
+		}
+		embeds = append(embeds, discordEmbed{
+			Title:       "Failed projects",
+			Description: truncateLines(lines, discordDescriptionLimit),
+			Color:       discordColorFailed,
+		})
+	}
+
+	messages := []discordMessage{{Content: truncate(content, discordContentLimit)}}
+	size := 0
+	for _, embed := range embeds {
+		last := &messages[len(messages)-1]
+		if len(last.Embeds) == discordEmbedsPerMessage || (len(last.Embeds) > 0 && size+embed.size() > discordMessageLimit) {
+			messages = append(messages, discordMessage{})
+			last = &messages[len(messages)-1]
+			size = 0
+		}
+		last.Embeds = append(last.Embeds, embed)
+		size += embed.size()
+	}
+	return messages
+}
+
+// Join lines up to max bytes, ending with a count of the lines left out.
+func truncateLines(lines []string, max int) string {
+	text := strings.Join(lines, "\n")
+	if len(text) <= max {
+		return text
+	}
+	var b strings.Builder
+	for i, line := range lines {
+		more := fmt.Sprintf("…and %d more", len(lines)-i)
+		if b.Len()+len(line)+1+len(more) > max {
+			b.WriteString(more)
+			break
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
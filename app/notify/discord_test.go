@@ -0,0 +1,274 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"tfdrift/app/terraform"
+)
+
+// Scan of root with drifted projects changing resources resources each, and failed projects.
+func testNotifyReport(drifted int, resources int, failed int) *terraform.ScanReport {
+	var services []*terraform.TerraformService
+	for i := 0; i < drifted; i++ {
+		service := terraform.NewProjectService(fmt.Sprintf("/infra/stacks/project-%03d", i))
+		service.SetStatus(terraform.StatusDrift)
+		var changes []terraform.ResourceDrift
+		for r := 0; r < resources; r++ {
+			changes = append(changes, terraform.ResourceDrift{
+				Address: fmt.Sprintf("module.network.aws_security_group_rule.ingress_from_the_office_network[%d]", r),
+				Action:  terraform.ActionUpdate,
+			})
+		}
+		service.SetResources(changes)
+		services = append(services, service)
+	}
+	for i := 0; i < failed; i++ {
+		service := terraform.NewProjectService(fmt.Sprintf("/infra/stacks/broken-%03d", i))
+		service.SetFailure(terraform.StatusPlanFailed, terraform.PhasePlan, fmt.Errorf("Error: Invalid value for \"region\""))
+		services = append(services, service)
+	}
+	return terraform.NewScanReport("/infra", "test", terraform.ModeFull, time.Now(), time.Now(), services)
+}
+
+// Check a message against Discord's limits: https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+func checkDiscordLimits(t *testing.T, n int, message discordMessage) {
+	t.Helper()
+	if utf8.RuneCountInString(message.Content) > discordContentLimit {
+		t.Errorf("message %d: content of %d characters", n, utf8.RuneCountInString(message.Content))
+	}
+	if len(message.Embeds) > discordEmbedsPerMessage {
+		t.Errorf("message %d: %d embeds", n, len(message.Embeds))
+	}
+	total := 0
+	for _, embed := range message.Embeds {
+		title, description := utf8.RuneCountInString(embed.Title), utf8.RuneCountInString(embed.Description)
+		if title > discordTitleLimit {
+			t.Errorf("message %d: embed title of %d characters", n, title)
+		}
+		if description > discordDescriptionLimit {
+			t.Errorf("message %d: embed description of %d characters", n, description)
+		}
+		total += title + description
+		for _, field := range embed.Fields {
+			total += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		}
+	}
+	if total > discordMessageLimit {
+		t.Errorf("message %d: embeds of %d characters", n, total)
+	}
+	if message.Content == "" && len(message.Embeds) == 0 {
+		t.Errorf("message %d is empty", n)
+	}
+}
+
+func TestDiscordMessages(t *testing.T) {
+	tests := []struct {
+		name             string
+		drifted          int
+		resources        int
+		failed           int
+		wantMessages     int
+		wantEmbedsInLast int
+	}{
+		{name: "no findings", wantMessages: 1},
+		{name: "one project", drifted: 1, resources: 3, wantMessages: 1, wantEmbedsInLast: 1},
+		{name: "ten embeds per message", drifted: 25, resources: 1, failed: 1, wantMessages: 3, wantEmbedsInLast: 6},
+		{name: "6000 characters per message", drifted: 12, resources: 30, wantMessages: 6, wantEmbedsInLast: 2},
+		{name: "long descriptions", drifted: 3, resources: 500, failed: 200, wantMessages: 4, wantEmbedsInLast: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := testNotifyReport(tt.drifted, tt.resources, tt.failed)
+			messages := DiscordMessages(report, "https://ci.example.com/jobs/1")
+			if len(messages) != tt.wantMessages {
+				t.Fatalf("DiscordMessages() = %d messages, want %d", len(messages), tt.wantMessages)
+			}
+			if got := len(messages[len(messages)-1].Embeds); got != tt.wantEmbedsInLast {
+				t.Errorf("last message has %d embeds, want %d", got, tt.wantEmbedsInLast)
+			}
+
+			var titles []string
+			for n, message := range messages {
+				checkDiscordLimits(t, n, message)
+				if n > 0 && message.Content != "" {
+					t.Errorf("message %d repeats the content", n)
+				}
+				for _, embed := range message.Embeds {
+					titles = append(titles, embed.Title)
+				}
+			}
+			// Every drifted project once, in order, then the failed projects
+			var want []string
+			for i := 0; i < tt.drifted; i++ {
+				want = append(want, fmt.Sprintf("stacks/project-%03d", i))
+			}
+			if tt.failed > 0 {
+				want = append(want, "Failed projects")
+			}
+			if strings.Join(titles, ",") != strings.Join(want, ",") {
+				t.Errorf("embed titles %q, want %q", titles, want)
+			}
+		})
+	}
+}
+
+func TestDiscordMessagesReportLink(t *testing.T) {
+	reportURL := "https://ci.example.com/jobs/1"
+	messages := DiscordMessages(testNotifyReport(12, 2, 1), reportURL)
+	if !strings.Contains(messages[0].Content, reportURL) {
+		t.Errorf("content %q does not link the report", messages[0].Content)
+	}
+	// Discord merges embeds of a message sharing a url into the first one
+	for n, message := range messages {
+		embeds, err := json.Marshal(message.Embeds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(embeds), reportURL) || strings.Contains(string(embeds), `"url"`) {
+			t.Errorf("message %d has the report link in its embeds: %s", n, embeds)
+		}
+	}
+}
+
+func TestDiscordMessagesTruncatedDescription(t *testing.T) {
+	messages := DiscordMessages(testNotifyReport(1, 500, 0), "")
+	description := messages[0].Embeds[0].Description
+	if !strings.HasSuffix(description, "more") || !strings.HasPrefix(description, "`update` module.network") {
+		t.Errorf("description does not end with the count of resources left out: …%s", description[len(description)-40:])
+	}
+}
+
+func TestDiscordRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		body   string
+		want   time.Duration
+	}{
+		{name: "body", body: `{"message": "You are being rate limited.", "retry_after": 0.35, "global": false}`, want: 350 * time.Millisecond},
+		{name: "body wins over the header", header: "3", body: `{"retry_after": 1.5}`, want: 1500 * time.Millisecond},
+		{name: "header", header: "2", body: `<html>`, want: 2 * time.Second},
+		{name: "neither", want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			if got := discordRetryAfter(resp, []byte(tt.body)); got != tt.want {
+				t.Errorf("discordRetryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Stand-in Discord webhook answering with the given statuses in turn, then 204.
+type discordServer struct {
+	mu       sync.Mutex
+	statuses []int
+	received []discordMessage
+	requests int
+}
+
+func (s *discordServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	body, _ := io.ReadAll(r.Body)
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			io.WriteString(w, `{"message": "You are being rate limited.", "retry_after": 0.01, "global": false}`)
+			return
+		}
+		if status/100 != 2 {
+			http.Error(w, `{"message": "Invalid Form Body", "code": 50035}`, status)
+			return
+		}
+	}
+	var message discordMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.received = append(s.received, message)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestDiscordNotifierRateLimit(t *testing.T) {
+	s := &discordServer{statuses: []int{http.StatusTooManyRequests, http.StatusNoContent, http.StatusTooManyRequests}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	report := testNotifyReport(15, 1, 0)
+	notifier := &DiscordNotifier{WebhookURL: server.URL}
+	if err := notifier.Notify(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+	// Each message retried once after its 429
+	if want := len(DiscordMessages(report, "")); len(s.received) != want || s.requests != want+2 {
+		t.Errorf("received %d messages in %d requests, want %d in %d", len(s.received), s.requests, want, want+2)
+	}
+	if len(s.received) > 0 && !strings.Contains(s.received[0].Content, "Terraform") {
+		t.Errorf("first message content %q", s.received[0].Content)
+	}
+}
+
+func TestDiscordNotifierErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantRequests int
+	}{
+		// Other errors are not retried
+		{name: "bad request", statuses: []int{http.StatusBadRequest}, wantRequests: 1},
+		{name: "always rate limited", statuses: []int{429, 429, 429, 429, 429, 429}, wantRequests: discordAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &discordServer{statuses: tt.statuses}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			err := (&DiscordNotifier{WebhookURL: server.URL}).Notify(context.Background(), testNotifyReport(1, 1, 0))
+			if err == nil || !strings.HasPrefix(err.Error(), "message 1 of 1: ") {
+				t.Errorf("Notify() = %v, want an error for the first message", err)
+			}
+			if s.requests != tt.wantRequests {
+				t.Errorf("%d requests, want %d", s.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestDiscordNotifierCancelledWhileRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"retry_after": 60}`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := (&DiscordNotifier{WebhookURL: server.URL}).Notify(ctx, testNotifyReport(1, 1, 0))
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("Notify() = %v, want the context error", err)
+	}
+}
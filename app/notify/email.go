@@ -0,0 +1,300 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// How the SMTP connection is secured.
+const (
+	// Plain connection upgraded with STARTTLS, which the server must support.
+	SMTPStartTLS = "starttls"
+	// TLS from the first byte, usually port 465.
+	SMTPTLS = "tls"
+	// No encryption, for local relays and test sinks.
+	SMTPNone = "none"
+)
+
+// One or more addresses that receive the projects under the given path prefixes (every project when empty).
+type EmailRecipient struct {
+	Addresses []string
+	Paths     []string
+}
+
+// Parse a --email-to value: "a@example.com,b@example.com" or "a@example.com=network/,shared/dns".
+func ParseEmailRecipient(value string) (EmailRecipient, error) {
+	var recipient EmailRecipient
+	addresses, paths, _ := strings.Cut(value, "=")
+	for _, address := range strings.Split(addresses, ",") {
+		parsed, err := mail.ParseAddress(strings.TrimSpace(address))
+		if err != nil {
+			return recipient, fmt.Errorf("--email-to %q: %w", value, err)
+		}
+		recipient.Addresses = append(recipient.Addresses, parsed.Address)
+	}
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.Trim(strings.TrimSpace(path), "/"); path != "" {
+			recipient.Paths = append(recipient.Paths, path)
+		}
+	}
+	return recipient, nil
+}
+
+// Check whether a project path is one of the recipient's paths or below one.
+func (r EmailRecipient) Matches(projectPath string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, path := range r.Paths {
+		if projectPath == path || strings.HasPrefix(projectPath, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Emails the static HTML report with a plaintext alternative. Each recipient only gets the projects
+// under its paths, and nothing when those projects have no findings (unless Always is set).
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Security string
+	Username string
+	Password string
+	From     string
+	// Subject prefix, the scan title is appended.
+	Subject    string
+	Recipients []EmailRecipient
+	ReportURL  string
+	Always     bool
+
+	// Certificate authorities trusted for the server, the system roots when nil.
+	rootCAs *x509.CertPool
+}
+
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Validate the configuration.
+func (e *EmailNotifier) Check() error {
+	if e.Host == "" {
+		return fmt.Errorf("email needs an SMTP host")
+	}
+	if _, err := mail.ParseAddress(e.From); err != nil {
+		return fmt.Errorf("email sender %q: %w", e.From, err)
+	}
+	switch e.Security {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return fmt.Errorf("--smtp-security %q not supported (%s, %s, %s)", e.Security, SMTPStartTLS, SMTPTLS, SMTPNone)
+	}
+	return nil
+}
+
+// Filtered recipients see only their projects, so the decision to send is made per recipient.
+func (e *EmailNotifier) EveryScan() bool {
+	return true
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	if err := e.Check(); err != nil {
+		return err
+	}
+	sent := 0
+	var firstErr error
+	for _, recipient := range e.Recipients {
+		filtered := report.Filter(func(service *terraform.TerraformService) bool {
+			return recipient.Matches(terraform.DisplayPath(report.RootPath, service))
+		})
+		if !e.Always && !HasFindings(filtered) {
+			log.Debugf("[EmailNotifier] Nothing to report to %s", strings.Join(recipient.Addresses, ", "))
+			continue
+		}
+		message, err := e.message(filtered, recipient.Addresses)
+		if err != nil {
+			return err
+		}
+		if err := e.send(ctx, recipient.Addresses, message); err != nil {
+			// Keep going, other recipients may use a different domain or relay rule
+			if firstErr == nil {
+				firstErr = fmt.Errorf("sending to %s: %w", strings.Join(recipient.Addresses, ", "), err)
+			}
+			continue
+		}
+		sent++
+	}
+	log.Debugf("[EmailNotifier] Sent %d of %d emails", sent, len(e.Recipients))
+	return firstErr
+}
+
+// Build a multipart/alternative message with the PrettyTable tables as text and the static HTML report.
+func (e *EmailNotifier) message(report *terraform.ScanReport, to []string) ([]byte, error) {
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "%s\n%s, mode %s\n\n", Title(report), report.RootPath, report.Mode)
+	terraform.RenderTable(&text, report.Projects)
+	if e.ReportURL != "" {
+		fmt.Fprintf(&text, "\nFull report: %s\n", e.ReportURL)
+	}
+	var html bytes.Buffer
+	if err := terraform.RenderHTML(&html, report, true); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	subject := Title(report)
+	if e.Subject != "" {
+		subject = e.Subject + " " + subject
+	}
+	sender, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return nil, err
+	}
+	var message bytes.Buffer
+	headers := [][2]string{
+		{"From", sender.String()},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(e.From)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// Deliver one message over SMTP.
+func (e *EmailNotifier) send(ctx context.Context, to []string, message []byte) error {
+	address := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	tlsConfig := &tls.Config{ServerName: e.Host, RootCAs: e.rootCAs}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if e.Security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if hostname, err := os.Hostname(); err == nil {
+		if err := client.Hello(hostname); err != nil {
+			return err
+		}
+	}
+	if e.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS, use --smtp-security tls or none", address)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection, except to localhost
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return err
+		}
+	}
+
+	sender, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	for _, address := range to {
+		if err := client.Rcpt(address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Unique Message-ID in the sender's domain.
+func messageID(from string) string {
+	domain := "tfdrift"
+	if sender, err := mail.ParseAddress(from); err == nil {
+		if _, host, ok := strings.Cut(sender.Address, "@"); ok {
+			domain = host
+		}
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return fmt.Sprintf("<%s.%s@%s>", strconv.FormatInt(time.Now().UnixNano(), 36), hex.EncodeToString(random), domain)
+}
@@ -0,0 +1,457 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tfdrift/app/terraform"
+)
+
+// A message accepted by smtpSink.
+type sinkMessage struct {
+	From string
+	To   []string
+	Data string
+	// The connection was upgraded with STARTTLS before MAIL.
+	TLS bool
+	// Decoded AUTH PLAIN credentials, empty without AUTH.
+	Auth string
+}
+
+// In-process SMTP server accepting every message, enough of RFC 5321 for net/smtp.
+type smtpSink struct {
+	listener net.Listener
+	// Offer STARTTLS with this certificate, none when nil.
+	tlsConfig *tls.Config
+	// Recipients refused with 550.
+	reject map[string]bool
+
+	mu       sync.Mutex
+	messages []sinkMessage
+	wg       sync.WaitGroup
+}
+
+func newSMTPSink(t *testing.T, tlsConfig *tls.Config) *smtpSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpSink{listener: listener, tlsConfig: tlsConfig, reject: make(map[string]bool)}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *smtpSink) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) received() []sinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMessage(nil), s.messages...)
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		for i, line := range lines {
+			sep := " "
+			if i < len(lines)-1 {
+				sep = "-"
+			}
+			io.WriteString(conn, line[:3]+sep+line[4:]+"\r\n")
+		}
+	}
+
+	var message sinkMessage
+	reply("220 sink ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			extensions := []string{"250 sink", "250 8BITMIME", "250 AUTH PLAIN"}
+			if s.tlsConfig != nil && !message.TLS {
+				extensions = append(extensions, "250 STARTTLS")
+			}
+			reply(extensions...)
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r = tlsConn, bufio.NewReader(tlsConn)
+			message.TLS = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			credentials, err := base64.StdEncoding.DecodeString(initial)
+			if mechanism != "PLAIN" || err != nil {
+				reply("504 unsupported")
+				continue
+			}
+			message.Auth = string(credentials)
+			reply("235 accepted")
+		case "MAIL":
+			// Parameters such as BODY=8BITMIME follow the address
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			message.From = strings.Trim(from, "<>")
+			reply("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if s.reject[to] {
+				reply("550 no such user")
+				continue
+			}
+			message.To = append(message.To, to)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			message.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			message = sinkMessage{TLS: message.TLS, Auth: message.Auth}
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// Certificate for 127.0.0.1 and a pool trusting it.
+func testCertificate(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(nil)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return &tls.Config{Certificates: server.TLS.Certificates}, roots
+}
+
+// Scan of /infra with drifted stacks/network and stacks/app, and a clean shared/dns.
+func testEmailReport() *terraform.ScanReport {
+	var services []*terraform.TerraformService
+	for _, project := range []string{"stacks/network", "stacks/app"} {
+		service := terraform.NewProjectService("/infra/" + project)
+		service.SetStatus(terraform.StatusDrift)
+		service.SetResources([]terraform.ResourceDrift{{Address: "aws_security_group.web", Action: terraform.ActionUpdate}})
+		services = append(services, service)
+	}
+	clean := terraform.NewProjectService("/infra/shared/dns")
+	clean.SetStatus(terraform.StatusNoDrift)
+	services = append(services, clean)
+	return terraform.NewScanReport("/infra", "test", terraform.ModeFull, time.Now(), time.Now(), services)
+}
+
+func emailRecipients(t *testing.T, values ...string) []EmailRecipient {
+	t.Helper()
+	var recipients []EmailRecipient
+	for _, value := range values {
+		recipient, err := ParseEmailRecipient(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients
+}
+
+// Text and HTML parts of a message, decoded, after checking they are quoted-printable.
+func emailParts(t *testing.T, data string) (*mail.Message, string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %q", msg.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	decoded := make(map[string]string)
+	for {
+		// Raw parts keep the Content-Transfer-Encoding header
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoding := part.Header.Get("Content-Transfer-Encoding"); encoding != "quoted-printable" {
+			t.Errorf("part %s is %q encoded", part.Header.Get("Content-Type"), encoding)
+		}
+		raw, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(raw), "\r\n") {
+			if len(line) > 76 {
+				t.Errorf("quoted-printable line of %d characters: %s", len(line), line)
+			}
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(string(raw))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		decoded[mediaType] = string(body)
+	}
+	return msg, decoded["text/plain"], decoded["text/html"]
+}
+
+func TestEmailNotifier(t *testing.T) {
+	tlsConfig, roots := testCertificate(t)
+	tests := []struct {
+		name      string
+		security  string
+		username  string
+		tlsConfig *tls.Config
+	}{
+		{name: SMTPNone, security: SMTPNone},
+		{name: SMTPStartTLS, security: SMTPStartTLS, username: "tfdrift", tlsConfig: tlsConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t, tt.tlsConfig)
+			notifier := &EmailNotifier{
+				Host:     "127.0.0.1",
+				Port:     sink.port(),
+				Security: tt.security,
+				Username: tt.username,
+				Password: "secret",
+				From:     "tfdrift <drift@example.com>",
+				Subject:  "[infra]",
+				Recipients: emailRecipients(t,
+					"platform@example.com,oncall@example.com",
+					"network@example.com=stacks/network/",
+					// Only a clean project: nothing to report
+					"dns@example.com=shared/dns",
+					// No project at all
+					"legacy@example.com=legacy",
+				),
+				ReportURL: "https://ci.example.com/jobs/1",
+				rootCAs:   roots,
+			}
+			if err := notifier.Notify(context.Background(), testEmailReport()); err != nil {
+				t.Fatal(err)
+			}
+
+			messages := sink.received()
+			if len(messages) != 2 {
+				t.Fatalf("sink received %d messages, want 2", len(messages))
+			}
+			wantTo := [][]string{{"platform@example.com", "oncall@example.com"}, {"network@example.com"}}
+			for i, message := range messages {
+				if !reflect.DeepEqual(message.To, wantTo[i]) || message.From != "drift@example.com" {
+					t.Errorf("message %d from %s to %v, want to %v", i, message.From, message.To, wantTo[i])
+				}
+				if message.TLS != (tt.security == SMTPStartTLS) {
+					t.Errorf("message %d sent with TLS %t", i, message.TLS)
+				}
+				if wantAuth := map[bool]string{true: "\x00tfdrift\x00secret", false: ""}[tt.username != ""]; message.Auth != wantAuth {
+					t.Errorf("message %d authenticated as %q, want %q", i, message.Auth, wantAuth)
+				}
+
+				msg, text, html := emailParts(t, message.Data)
+				if subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); err != nil || !strings.HasPrefix(subject, "[infra] ") {
+					t.Errorf("message %d subject %q", i, subject)
+				}
+				if to := msg.Header.Get("To"); to != strings.Join(wantTo[i], ", ") {
+					t.Errorf("message %d To header %q", i, to)
+				}
+				if msg.Header.Get("Message-ID") == "" || msg.Header.Get("Date") == "" {
+					t.Errorf("message %d has no Message-ID or Date", i)
+				}
+				// The text table names projects, the HTML report gives their paths
+				for _, want := range []string{"│ network ", "https://ci.example.com/jobs/1"} {
+					if !strings.Contains(text, want) {
+						t.Errorf("message %d text does not contain %q:\n%s", i, want, text)
+					}
+				}
+				if !strings.Contains(html, "<html") || !strings.Contains(html, "stacks/network") {
+					t.Errorf("message %d has no HTML report", i)
+				}
+			}
+			// The network team only sees its project
+			_, text, html := emailParts(t, messages[1].Data)
+			if strings.Contains(text, "│ app ") || strings.Contains(html, "stacks/app") {
+				t.Errorf("filtered message contains stacks/app:\n%s", text)
+			}
+			if _, text, html := emailParts(t, messages[0].Data); !strings.Contains(text, "│ app ") || !strings.Contains(html, "stacks/app") {
+				t.Errorf("unfiltered message does not contain stacks/app:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestEmailNotifierAlways(t *testing.T) {
+	sink := newSMTPSink(t, nil)
+	notifier := &EmailNotifier{
+		Host:       "127.0.0.1",
+		Port:       sink.port(),
+		Security:   SMTPNone,
+		From:       "drift@example.com",
+		Recipients: emailRecipients(t, "dns@example.com=shared/dns"),
+	}
+	if err := notifier.Notify(context.Background(), testEmailReport()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sink.received()); n != 0 {
+		t.Fatalf("sink received %d messages for a clean project", n)
+	}
+
+	notifier.Always = true
+	if err := notifier.Notify(context.Background(), testEmailReport()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sink.received()); n != 1 {
+		t.Fatalf("sink received %d messages with Always, want 1", n)
+	}
+}
+
+func TestEmailNotifierErrors(t *testing.T) {
+	t.Run("STARTTLS not offered", func(t *testing.T) {
+		sink := newSMTPSink(t, nil)
+		notifier := &EmailNotifier{
+			Host:       "127.0.0.1",
+			Port:       sink.port(),
+			Security:   SMTPStartTLS,
+			From:       "drift@example.com",
+			Recipients: emailRecipients(t, "platform@example.com"),
+		}
+		err := notifier.Notify(context.Background(), testEmailReport())
+		if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+			t.Errorf("Notify() = %v, want a STARTTLS error", err)
+		}
+		if n := len(sink.received()); n != 0 {
+			t.Errorf("sink received %d messages in plain text", n)
+		}
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		tlsConfig, _ := testCertificate(t)
+		sink := newSMTPSink(t, tlsConfig)
+		notifier := &EmailNotifier{
+			Host:       "127.0.0.1",
+			Port:       sink.port(),
+			Security:   SMTPStartTLS,
+			From:       "drift@example.com",
+			Recipients: emailRecipients(t, "platform@example.com"),
+		}
+		if err := notifier.Notify(context.Background(), testEmailReport()); err == nil {
+			t.Error("Notify() trusted a self-signed certificate")
+		}
+	})
+
+	t.Run("refused recipient", func(t *testing.T) {
+		sink := newSMTPSink(t, nil)
+		sink.reject["gone@example.com"] = true
+		notifier := &EmailNotifier{
+			Host:       "127.0.0.1",
+			Port:       sink.port(),
+			Security:   SMTPNone,
+			From:       "drift@example.com",
+			Recipients: emailRecipients(t, "gone@example.com", "platform@example.com"),
+		}
+		err := notifier.Notify(context.Background(), testEmailReport())
+		if err == nil || !strings.Contains(err.Error(), "gone@example.com") {
+			t.Errorf("Notify() = %v, want an error for gone@example.com", err)
+		}
+		// The other recipients still get their email
+		if messages := sink.received(); len(messages) != 1 || messages[0].To[0] != "platform@example.com" {
+			t.Errorf("sink received %+v", messages)
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		notifier := &EmailNotifier{Host: "127.0.0.1", Port: 25, Security: "ssl", From: "drift@example.com"}
+		if err := notifier.Notify(context.Background(), testEmailReport()); err == nil {
+			t.Error("Notify() accepted --smtp-security ssl")
+		}
+	})
+}
+
+func TestEmailRecipientMatches(t *testing.T) {
+	recipient, err := ParseEmailRecipient("Network Team <network@example.com>, sre@example.com = /stacks/network/, shared/dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"network@example.com", "sre@example.com"}; !reflect.DeepEqual(recipient.Addresses, want) {
+		t.Errorf("Addresses = %v, want %v", recipient.Addresses, want)
+	}
+	for path, want := range map[string]bool{
+		"stacks/network":        true,
+		"stacks/network/vpc":    true,
+		"stacks/network-shared": false,
+		"shared/dns":            true,
+		"shared":                false,
+		"stacks/app":            false,
+	} {
+		if got := recipient.Matches(path); got != want {
+			t.Errorf("Matches(%q) = %t, want %t", path, got, want)
+		}
+	}
+	if _, err := ParseEmailRecipient("not an address=stacks"); err == nil {
+		t.Error("ParseEmailRecipient accepted an invalid address")
+	}
+}
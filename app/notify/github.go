@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tfdrift/log"
+)
+
+// GitHub REST API, GitHub Enterprise Server uses https://<host>/api/v3.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// Issues per listing page, the most both GitHub and GitLab return.
+const issuesPerPage = 100
+
+// Listing pages read at most.
+const maxIssuePages = 50
+
+// Issues of a GitHub repository, through the REST API with a token allowed to write issues.
+type GitHubIssues struct {
+	// owner/name
+	Repository string
+	Token      string
+	// REST API base URL, DefaultGitHubAPIURL when empty.
+	APIURL string
+}
+
+type githubIssue struct {
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+func (g *GitHubIssues) Name() string {
+	return "github issues"
+}
+
+// Validate the configuration.
+func (g *GitHubIssues) Check() error {
+	if owner, name, ok := strings.Cut(g.Repository, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("GitHub repository %q is not in the form owner/name", g.Repository)
+	}
+	if g.Token == "" {
+		return fmt.Errorf("GitHub issues need a token")
+	}
+	return nil
+}
+
+func (g *GitHubIssues) OpenIssues(ctx context.Context, labels []string) ([]Issue, error) {
+	var issues []Issue
+	for page := 1; page <= maxIssuePages; page++ {
+		query := url.Values{
+			"state":    {"open"},
+			"per_page": {fmt.Sprint(issuesPerPage)},
+			"page":     {fmt.Sprint(page)},
+		}
+		if len(labels) > 0 {
+			query.Set("labels", strings.Join(labels, ","))
+		}
+		var batch []githubIssue
+		if err := g.request(ctx, http.MethodGet, "/issues?"+query.Encode(), nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, issue := range batch {
+			// The issues API lists pull requests too
+			if issue.PullRequest == nil {
+				issues = append(issues, Issue{Number: issue.Number, Title: issue.Title, Body: issue.Body})
+			}
+		}
+		if len(batch) < issuesPerPage {
+			break
+		}
+	}
+	return issues, nil
+}
+
+func (g *GitHubIssues) CreateIssue(ctx context.Context, title string, body string, labels []string, assignees []string) error {
+	issue := map[string]interface{}{
+		"title":  title,
+		"body":   body,
+		"labels": labels,
+	}
+	if len(assignees) > 0 {
+		issue["assignees"] = assignees
+	}
+	err := g.request(ctx, http.MethodPost, "/issues", issue, nil)
+	if err != nil && len(assignees) > 0 && strings.HasPrefix(err.Error(), "422") {
+		// Owners without access to the repository cannot be assigned
+		log.Printf("[GitHubIssues] Unable to assign %s, opening the issue unassigned: %s", strings.Join(assignees, ", "), err)
+		delete(issue, "assignees")
+		err = g.request(ctx, http.MethodPost, "/issues", issue, nil)
+	}
+	return err
+}
+
+func (g *GitHubIssues) UpdateIssue(ctx context.Context, issue Issue) error {
+	return g.request(ctx, http.MethodPatch, fmt.Sprintf("/issues/%d", issue.Number),
+		map[string]string{"title": issue.Title, "body": issue.Body}, nil)
+}
+
+func (g *GitHubIssues) CloseIssue(ctx context.Context, issue Issue, comment string) error {
+	if err := g.request(ctx, http.MethodPost, fmt.Sprintf("/issues/%d/comments", issue.Number),
+		map[string]string{"body": comment}, nil); err != nil {
+		return err
+	}
+	return g.request(ctx, http.MethodPatch, fmt.Sprintf("/issues/%d", issue.Number),
+		map[string]string{"state": "closed", "state_reason": "completed"}, nil)
+}
+
+// Call a repository endpoint and decode the response into result, unless nil.
+func (g *GitHubIssues) request(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	apiURL := g.APIURL
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s%s", strings.TrimRight(apiURL, "/"), g.Repository, path)
+	resp, respBody, err := requestJSON(ctx, method, endpoint, map[string]string{
+		"Authorization":        "Bearer " + g.Token,
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": "2022-11-28",
+		"User-Agent":           "tfdrift",
+	}, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, respBody)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("unexpected response from %s %s: %w", method, path, err)
+	}
+	return nil
+}
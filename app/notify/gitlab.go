@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tfdrift/log"
+)
+
+// GitLab REST API of gitlab.com.
+const DefaultGitLabAPIURL = "https://gitlab.com/api/v4"
+
+// Issues of a GitLab project, through the REST API with a token allowed to write issues (the CI job
+// token is not).
+type GitLabIssues struct {
+	// Project ID or path, e.g. group/project.
+	Project string
+	Token   string
+	// REST API base URL, DefaultGitLabAPIURL when empty.
+	APIURL string
+}
+
+type gitlabIssue struct {
+	IID         int    `json:"iid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+func (g *GitLabIssues) Name() string {
+	return "gitlab issues"
+}
+
+// Validate the configuration.
+func (g *GitLabIssues) Check() error {
+	if g.Project == "" {
+		return fmt.Errorf("GitLab issues need a project ID or path")
+	}
+	if g.Token == "" {
+		return fmt.Errorf("GitLab issues need a token")
+	}
+	return nil
+}
+
+func (g *GitLabIssues) OpenIssues(ctx context.Context, labels []string) ([]Issue, error) {
+	var issues []Issue
+	for page := 1; page <= maxIssuePages; page++ {
+		query := url.Values{
+			"state":    {"opened"},
+			"per_page": {fmt.Sprint(issuesPerPage)},
+			"page":     {fmt.Sprint(page)},
+		}
+		if len(labels) > 0 {
+			query.Set("labels", strings.Join(labels, ","))
+		}
+		var batch []gitlabIssue
+		if err := g.request(ctx, http.MethodGet, g.projectPath("/issues?"+query.Encode()), nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, issue := range batch {
+			issues = append(issues, Issue{Number: issue.IID, Title: issue.Title, Body: issue.Description})
+		}
+		if len(batch) < issuesPerPage {
+			break
+		}
+	}
+	return issues, nil
+}
+
+func (g *GitLabIssues) CreateIssue(ctx context.Context, title string, body string, labels []string, assignees []string) error {
+	issue := map[string]interface{}{
+		"title":       title,
+		"description": body,
+		"labels":      strings.Join(labels, ","),
+	}
+	if ids := g.userIDs(ctx, assignees); len(ids) > 0 {
+		issue["assignee_ids"] = ids
+	}
+	return g.request(ctx, http.MethodPost, g.projectPath("/issues"), issue, nil)
+}
+
+func (g *GitLabIssues) UpdateIssue(ctx context.Context, issue Issue) error {
+	return g.request(ctx, http.MethodPut, g.projectPath(fmt.Sprintf("/issues/%d", issue.Number)),
+		map[string]string{"title": issue.Title, "description": issue.Body}, nil)
+}
+
+func (g *GitLabIssues) CloseIssue(ctx context.Context, issue Issue, comment string) error {
+	if err := g.request(ctx, http.MethodPost, g.projectPath(fmt.Sprintf("/issues/%d/notes", issue.Number)),
+		map[string]string{"body": comment}, nil); err != nil {
+		return err
+	}
+	return g.request(ctx, http.MethodPut, g.projectPath(fmt.Sprintf("/issues/%d", issue.Number)),
+		map[string]string{"state_event": "close"}, nil)
+}
+
+// IDs of the users with these usernames. Unknown usernames, e.g. groups, are skipped.
+func (g *GitLabIssues) userIDs(ctx context.Context, usernames []string) []int {
+	var ids []int
+	for _, username := range usernames {
+		var users []struct {
+			ID int `json:"id"`
+		}
+		if err := g.request(ctx, http.MethodGet, "/users?username="+url.QueryEscape(username), nil, &users); err != nil {
+			log.Printf("[GitLabIssues] Unable to look up user %s: %s", username, err)
+			continue
+		}
+		if len(users) == 0 {
+			log.Debugf("[GitLabIssues] No user %s, not assigning", username)
+			continue
+		}
+		ids = append(ids, users[0].ID)
+	}
+	return ids
+}
+
+// Path of a project endpoint.
+func (g *GitLabIssues) projectPath(path string) string {
+	return "/projects/" + url.PathEscape(g.Project) + path
+}
+
+// Call an endpoint and decode the response into result, unless nil.
+func (g *GitLabIssues) request(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	apiURL := g.APIURL
+	if apiURL == "" {
+		apiURL = DefaultGitLabAPIURL
+	}
+	resp, respBody, err := requestJSON(ctx, method, strings.TrimRight(apiURL, "/")+path,
+		map[string]string{"PRIVATE-TOKEN": g.Token}, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, respBody)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("unexpected response from %s %s: %w", method, path, err)
+	}
+	return nil
+}
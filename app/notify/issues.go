@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// Issue trackers.
+const (
+	IssuesGitHub = "github"
+	IssuesGitLab = "gitlab"
+)
+
+// Default labels of drift issues.
+var DefaultIssueLabels = []string{"tfdrift", "drift"}
+
+// Issue body size kept well under GitHub's 65536 character limit.
+const issueBodyLimit = 60000
+
+// Most assignees GitHub accepts on an issue.
+const maxIssueAssignees = 10
+
+// Hidden marker identifying the project an issue tracks.
+var issueMarkerPattern = regexp.MustCompile(`<!-- tfdrift:project=(.*?) -->`)
+
+// An open issue. Number is the GitHub issue number or the GitLab issue IID.
+type Issue struct {
+	Number int
+	Title  string
+	Body   string
+}
+
+// Issue API of a repository.
+type IssueTracker interface {
+	Name() string
+	// Open issues that have every label.
+	OpenIssues(ctx context.Context, labels []string) ([]Issue, error)
+	// Open an issue, assigned to the given usernames when the tracker knows them.
+	CreateIssue(ctx context.Context, title string, body string, labels []string, assignees []string) error
+	UpdateIssue(ctx context.Context, issue Issue) error
+	// Comment on an issue and close it.
+	CloseIssue(ctx context.Context, issue Issue, comment string) error
+}
+
+// Keeps one issue open per drifted project: opened on the first scan that finds drift, updated by the
+// following scans and closed once a scan finds the project without drift. Issues are matched to projects
+// through a hidden marker in their body, among the open issues having every label.
+type IssueNotifier struct {
+	Tracker IssueTracker
+	Labels  []string
+	// Assignees are taken from the project owners, none when nil.
+	CodeOwners *CodeOwners
+	ReportURL  string
+}
+
+func (i *IssueNotifier) Name() string {
+	return i.Tracker.Name()
+}
+
+// Clean scans close the issues opened by earlier scans.
+func (i *IssueNotifier) EveryScan() bool {
+	return true
+}
+
+func (i *IssueNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	issues, err := i.Tracker.OpenIssues(ctx, i.Labels)
+	if err != nil {
+		return fmt.Errorf("listing issues: %w", err)
+	}
+	// The oldest issue wins when a project has several
+	sort.Slice(issues, func(a, b int) bool { return issues[a].Number < issues[b].Number })
+	byProject := make(map[string]Issue)
+	for _, issue := range issues {
+		if match := issueMarkerPattern.FindStringSubmatch(issue.Body); match != nil {
+			if _, ok := byProject[match[1]]; !ok {
+				byProject[match[1]] = issue
+			}
+		}
+	}
+
+	var firstErr error
+	fail := func(action string, project string, err error) {
+		log.Errorf("[IssueNotifier] Unable to %s the issue of %s: %s", action, project, err)
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s issue of %s: %w", action, project, err)
+		}
+	}
+	var opened, updated, closed int
+	for _, service := range report.Projects {
+		project := terraform.DisplayPath(report.RootPath, service)
+		issue, open := byProject[project]
+		switch {
+		case service.Status == terraform.StatusDrift && open:
+			title, body := i.issueTitle(project), i.issueBody(report, service)
+			if issue.Title == title && issue.Body == body {
+				continue
+			}
+			issue.Title, issue.Body = title, body
+			if err := i.Tracker.UpdateIssue(ctx, issue); err != nil {
+				fail("update", project, err)
+				continue
+			}
+			updated++
+		case service.Status == terraform.StatusDrift:
+			var assignees []string
+			if i.CodeOwners != nil {
+				assignees = issueAssignees(i.CodeOwners.ProjectOwners(service.ProjectPath))
+			}
+			if err := i.Tracker.CreateIssue(ctx, i.issueTitle(project), i.issueBody(report, service), i.Labels, assignees); err != nil {
+				fail("open", project, err)
+				continue
+			}
+			opened++
+		case service.Status == terraform.StatusNoDrift && open:
+			comment := "The latest scan found no drift in this project, closing."
+			if i.ReportURL != "" {
+				comment += fmt.Sprintf(" See the [report](%s).", i.ReportURL)
+			}
+			if err := i.Tracker.CloseIssue(ctx, issue, comment); err != nil {
+				fail("close", project, err)
+				continue
+			}
+			closed++
+		}
+	}
+	log.Printf("[IssueNotifier] Opened %d, updated %d and closed %d issues", opened, updated, closed)
+	return firstErr
+}
+
+func (i *IssueNotifier) issueTitle(project string) string {
+	return "Terraform drift in " + project
+}
+
+// Issue body: the marker, the project's drift and trimmed plan, and a link to the report.
+func (i *IssueNotifier) issueBody(report *terraform.ScanReport, service *terraform.TerraformService) string {
+	project := terraform.DisplayPath(report.RootPath, service)
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- tfdrift:project=%s -->\n", project)
+	b.WriteString("Terraform plans changes for this project, the infrastructure no longer matches its code.\n\n")
+	footer := "_This issue is updated by tfdrift on every scan and closed once the project has no drift._\n"
+	if i.ReportURL != "" {
+		footer = fmt.Sprintf("[Latest report](%s)\n\n", i.ReportURL) + footer
+	}
+	b.WriteString(terraform.RenderProjectMarkdown(report, service, issueBodyLimit-b.Len()-len(footer)))
+	b.WriteString(footer)
+	return b.String()
+}
+
+// Usernames among CODEOWNERS owners. Teams (@org/team) and email addresses cannot be assigned.
+func issueAssignees(owners []string) []string {
+	var assignees []string
+	for _, owner := range owners {
+		if strings.HasPrefix(owner, "@") && !strings.Contains(owner, "/") {
+			assignees = append(assignees, strings.TrimPrefix(owner, "@"))
+		}
+		if len(assignees) == maxIssueAssignees {
+			break
+		}
+	}
+	return assignees
+}
@@ -0,0 +1,543 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"tfdrift/app/terraform"
+)
+
+// An issue kept by issueServer.
+type fakeIssue struct {
+	Number      int
+	Title       string
+	Body        string
+	Labels      []string
+	Assignees   []string
+	Comments    []string
+	Open        bool
+	PullRequest bool
+}
+
+// Stand-in for the issue endpoints of the GitHub and GitLab REST APIs used by GitHubIssues and GitLabIssues.
+type issueServer struct {
+	t *testing.T
+
+	mu     sync.Mutex
+	issues []*fakeIssue
+	// Method and path of every request modifying an issue.
+	writes []string
+	// Users known to GitLab, by username.
+	users map[string]int
+	// GitHub usernames that cannot be assigned.
+	unassignable map[string]bool
+}
+
+func newIssueServer(t *testing.T) (*issueServer, *httptest.Server) {
+	s := &issueServer{
+		t:            t,
+		users:        map[string]int{"alice": 7},
+		unassignable: map[string]bool{"mallory": true},
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *issueServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := r.URL.EscapedPath()
+	switch {
+	case strings.HasPrefix(path, "/repos/acme/infra/issues"):
+		if r.Header.Get("Authorization") != "Bearer github-token" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		s.serveGitHub(w, r, strings.TrimPrefix(path, "/repos/acme/infra/issues"))
+	case strings.HasPrefix(path, "/projects/acme%2Finfra/issues"), path == "/users":
+		if r.Header.Get("PRIVATE-TOKEN") != "gitlab-token" {
+			http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		s.serveGitLab(w, r, strings.TrimPrefix(path, "/projects/acme%2Finfra/issues"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *issueServer) serveGitHub(w http.ResponseWriter, r *http.Request, path string) {
+	var body struct {
+		Title       *string  `json:"title"`
+		Body        *string  `json:"body"`
+		Labels      []string `json:"labels"`
+		Assignees   []string `json:"assignees"`
+		State       string   `json:"state"`
+		StateReason string   `json:"state_reason"`
+	}
+	if r.Body != nil && r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	number, sub := s.issuePath(path)
+	if number > 0 && s.find(number) == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		if r.URL.Query().Get("state") != "open" {
+			s.t.Errorf("GitHub listing with state %q", r.URL.Query().Get("state"))
+		}
+		var list []map[string]interface{}
+		for _, issue := range s.listed(r.URL.Query().Get("labels"), r.URL.Query().Get("page")) {
+			item := map[string]interface{}{"number": issue.Number, "title": issue.Title, "body": issue.Body}
+			if issue.PullRequest {
+				item["pull_request"] = map[string]string{"url": "https://example.com/pull/1"}
+			}
+			list = append(list, item)
+		}
+		writeJSON(w, http.StatusOK, list)
+	case r.Method == http.MethodPost && path == "":
+		for _, assignee := range body.Assignees {
+			if s.unassignable[assignee] {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed"})
+				return
+			}
+		}
+		issue := s.create(deref(body.Title), deref(body.Body), body.Labels, body.Assignees)
+		s.writes = append(s.writes, "POST /issues")
+		writeJSON(w, http.StatusCreated, map[string]int{"number": issue.Number})
+	case r.Method == http.MethodPatch && number > 0 && sub == "":
+		issue := s.find(number)
+		if body.Title != nil {
+			issue.Title = *body.Title
+		}
+		if body.Body != nil {
+			issue.Body = *body.Body
+		}
+		if body.State == "closed" {
+			if body.StateReason != "completed" {
+				s.t.Errorf("GitHub issue closed with state_reason %q", body.StateReason)
+			}
+			issue.Open = false
+		}
+		s.writes = append(s.writes, fmt.Sprintf("PATCH /issues/%d", number))
+		writeJSON(w, http.StatusOK, map[string]int{"number": number})
+	case r.Method == http.MethodPost && number > 0 && sub == "/comments":
+		issue := s.find(number)
+		issue.Comments = append(issue.Comments, deref(body.Body))
+		s.writes = append(s.writes, fmt.Sprintf("POST /issues/%d/comments", number))
+		writeJSON(w, http.StatusCreated, map[string]int{"id": 1})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *issueServer) serveGitLab(w http.ResponseWriter, r *http.Request, path string) {
+	if r.URL.Path == "/users" {
+		var users []map[string]int
+		if id, ok := s.users[r.URL.Query().Get("username")]; ok {
+			users = append(users, map[string]int{"id": id})
+		}
+		writeJSON(w, http.StatusOK, users)
+		return
+	}
+	var body struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Body        string  `json:"body"`
+		Labels      string  `json:"labels"`
+		AssigneeIDs []int   `json:"assignee_ids"`
+		StateEvent  string  `json:"state_event"`
+	}
+	if r.Body != nil && r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	number, sub := s.issuePath(path)
+	if number > 0 && s.find(number) == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		if r.URL.Query().Get("state") != "opened" {
+			s.t.Errorf("GitLab listing with state %q", r.URL.Query().Get("state"))
+		}
+		var list []map[string]interface{}
+		for _, issue := range s.listed(r.URL.Query().Get("labels"), r.URL.Query().Get("page")) {
+			list = append(list, map[string]interface{}{"iid": issue.Number, "title": issue.Title, "description": issue.Body})
+		}
+		writeJSON(w, http.StatusOK, list)
+	case r.Method == http.MethodPost && path == "":
+		var assignees []string
+		for _, id := range body.AssigneeIDs {
+			assignees = append(assignees, strconv.Itoa(id))
+		}
+		issue := s.create(deref(body.Title), deref(body.Description), strings.Split(body.Labels, ","), assignees)
+		s.writes = append(s.writes, "POST /issues")
+		writeJSON(w, http.StatusCreated, map[string]int{"iid": issue.Number})
+	case r.Method == http.MethodPut && number > 0 && sub == "":
+		issue := s.find(number)
+		if body.Title != nil {
+			issue.Title = *body.Title
+		}
+		if body.Description != nil {
+			issue.Body = *body.Description
+		}
+		if body.StateEvent == "close" {
+			issue.Open = false
+		}
+		s.writes = append(s.writes, fmt.Sprintf("PUT /issues/%d", number))
+		writeJSON(w, http.StatusOK, map[string]int{"iid": number})
+	case r.Method == http.MethodPost && number > 0 && sub == "/notes":
+		issue := s.find(number)
+		issue.Comments = append(issue.Comments, body.Body)
+		s.writes = append(s.writes, fmt.Sprintf("POST /issues/%d/notes", number))
+		writeJSON(w, http.StatusCreated, map[string]int{"id": 1})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Issue number and the rest of a path below /issues, e.g. /12/comments.
+func (s *issueServer) issuePath(path string) (int, string) {
+	rest := strings.TrimPrefix(path, "/")
+	numberPart, sub, _ := strings.Cut(rest, "/")
+	number, err := strconv.Atoi(numberPart)
+	if err != nil {
+		return 0, ""
+	}
+	if sub != "" {
+		sub = "/" + sub
+	}
+	return number, sub
+}
+
+// Open issues having every label, newest first like both APIs, on pages of issuesPerPage.
+func (s *issueServer) listed(labels string, page string) []*fakeIssue {
+	var matching []*fakeIssue
+	for i := len(s.issues) - 1; i >= 0; i-- {
+		issue := s.issues[i]
+		if issue.Open && hasLabels(issue.Labels, labels) {
+			matching = append(matching, issue)
+		}
+	}
+	n, _ := strconv.Atoi(page)
+	if n < 1 {
+		n = 1
+	}
+	start := (n - 1) * issuesPerPage
+	if start >= len(matching) {
+		return nil
+	}
+	end := start + issuesPerPage
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[start:end]
+}
+
+func (s *issueServer) create(title string, body string, labels []string, assignees []string) *fakeIssue {
+	issue := &fakeIssue{
+		Number:    len(s.issues) + 1,
+		Title:     title,
+		Body:      body,
+		Labels:    labels,
+		Assignees: assignees,
+		Open:      true,
+	}
+	s.issues = append(s.issues, issue)
+	return issue
+}
+
+func (s *issueServer) find(number int) *fakeIssue {
+	if number < 1 || number > len(s.issues) {
+		return nil
+	}
+	return s.issues[number-1]
+}
+
+// Add an issue created outside of tfdrift.
+func (s *issueServer) seed(issue fakeIssue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	issue.Number = len(s.issues) + 1
+	issue.Open = true
+	s.issues = append(s.issues, &issue)
+}
+
+// Writes since the last call.
+func (s *issueServer) takeWrites() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writes := s.writes
+	s.writes = nil
+	return writes
+}
+
+func (s *issueServer) issue(number int) fakeIssue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	issue := s.find(number)
+	if issue == nil {
+		s.t.Fatalf("no issue %d", number)
+	}
+	return *issue
+}
+
+func hasLabels(issueLabels []string, labels string) bool {
+	if labels == "" {
+		return true
+	}
+	for _, label := range strings.Split(labels, ",") {
+		found := false
+		for _, issueLabel := range issueLabels {
+			found = found || issueLabel == label
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Scan of root with a drifted, a clean and a failed project.
+func testIssueReport(root string, network terraform.Status, resources ...string) *terraform.ScanReport {
+	service := func(name string, status terraform.Status) *terraform.TerraformService {
+		s := terraform.NewProjectService(filepath.Join(root, "stacks", name))
+		s.SetStatus(status)
+		s.Mode = terraform.ModeFull
+		s.TerraformVersion = "1.5.7"
+		return s
+	}
+	drifted := service("network", network)
+	if network == terraform.StatusDrift {
+		for _, address := range resources {
+			drifted.Resources = append(drifted.Resources, terraform.ResourceDrift{Address: address, Action: terraform.ActionUpdate})
+		}
+		drifted.PlanOutput = "  # " + strings.Join(resources, " will be updated in-place\n  # ") + " will be updated in-place\n"
+	}
+	return &terraform.ScanReport{
+		RootPath: root,
+		Projects: []*terraform.TerraformService{
+			drifted,
+			service("app", terraform.StatusNoDrift),
+			service("legacy", terraform.StatusPlanFailed),
+		},
+	}
+}
+
+func TestIssueNotifier(t *testing.T) {
+	trackers := []struct {
+		name          string
+		tracker       func(apiURL string) IssueTracker
+		update        string
+		comment       string
+		wantAssignees []string
+	}{
+		{
+			name: IssuesGitHub,
+			tracker: func(apiURL string) IssueTracker {
+				return &GitHubIssues{Repository: "acme/infra", Token: "github-token", APIURL: apiURL}
+			},
+			update:  "PATCH",
+			comment: "comments",
+			// mallory cannot be assigned, the issue is opened unassigned
+			wantAssignees: nil,
+		},
+		{
+			name: IssuesGitLab,
+			tracker: func(apiURL string) IssueTracker {
+				return &GitLabIssues{Project: "acme/infra", Token: "gitlab-token", APIURL: apiURL}
+			},
+			update:  "PUT",
+			comment: "notes",
+			// Only alice has a GitLab account
+			wantAssignees: []string{"7"},
+		},
+	}
+
+	for _, tt := range trackers {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range map[string]string{
+				"CODEOWNERS":             "/stacks/network/ @alice @mallory @acme/network\n",
+				"stacks/network/main.tf": "",
+				".git/HEAD":              "",
+			} {
+				path := filepath.Join(root, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			codeOwners, err := LoadCodeOwners(filepath.Join(root, "CODEOWNERS"), root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, server := newIssueServer(t)
+			// Issues tfdrift must leave alone: without the labels, without a marker, a pull request
+			s.seed(fakeIssue{Title: "Unlabelled", Body: "<!-- tfdrift:project=stacks/network -->", Labels: []string{"bug"}})
+			s.seed(fakeIssue{Title: "Unrelated", Body: "Not from tfdrift", Labels: DefaultIssueLabels})
+			if tt.name == IssuesGitHub {
+				s.seed(fakeIssue{Title: "PR", Body: "<!-- tfdrift:project=stacks/network -->", Labels: DefaultIssueLabels, PullRequest: true})
+			}
+			first := len(s.issues) + 1
+
+			notifier := &IssueNotifier{
+				Tracker:    tt.tracker(server.URL),
+				Labels:     DefaultIssueLabels,
+				CodeOwners: codeOwners,
+				ReportURL:  "https://ci.example.com/report.html",
+			}
+			ctx := context.Background()
+
+			// Drift found: the issue is opened
+			if err := notifier.Notify(ctx, testIssueReport(root, terraform.StatusDrift, "aws_vpc.main")); err != nil {
+				t.Fatal(err)
+			}
+			if writes := s.takeWrites(); !reflect.DeepEqual(writes, []string{"POST /issues"}) {
+				t.Fatalf("first scan made %v", writes)
+			}
+			issue := s.issue(first)
+			if issue.Title != "Terraform drift in stacks/network" {
+				t.Errorf("title %q", issue.Title)
+			}
+			for _, want := range []string{"<!-- tfdrift:project=stacks/network -->", "aws_vpc.main", "(https://ci.example.com/report.html)"} {
+				if !strings.Contains(issue.Body, want) {
+					t.Errorf("body does not contain %q:\n%s", want, issue.Body)
+				}
+			}
+			if !reflect.DeepEqual(issue.Labels, DefaultIssueLabels) {
+				t.Errorf("labels %v, want %v", issue.Labels, DefaultIssueLabels)
+			}
+			if !reflect.DeepEqual(issue.Assignees, tt.wantAssignees) {
+				t.Errorf("assignees %v, want %v", issue.Assignees, tt.wantAssignees)
+			}
+
+			// Same drift: nothing to write
+			if err := notifier.Notify(ctx, testIssueReport(root, terraform.StatusDrift, "aws_vpc.main")); err != nil {
+				t.Fatal(err)
+			}
+			if writes := s.takeWrites(); len(writes) != 0 {
+				t.Fatalf("unchanged scan made %v", writes)
+			}
+
+			// More drift: the same issue is updated
+			if err := notifier.Notify(ctx, testIssueReport(root, terraform.StatusDrift, "aws_vpc.main", "aws_subnet.private")); err != nil {
+				t.Fatal(err)
+			}
+			if writes, want := s.takeWrites(), []string{fmt.Sprintf("%s /issues/%d", tt.update, first)}; !reflect.DeepEqual(writes, want) {
+				t.Fatalf("changed scan made %v, want %v", writes, want)
+			}
+			if issue := s.issue(first); !issue.Open || !strings.Contains(issue.Body, "aws_subnet.private") {
+				t.Errorf("issue not updated:\n%s", issue.Body)
+			}
+
+			// A failed plan says nothing about drift: the issue stays open
+			if err := notifier.Notify(ctx, testIssueReport(root, terraform.StatusPlanFailed)); err != nil {
+				t.Fatal(err)
+			}
+			if writes := s.takeWrites(); len(writes) != 0 {
+				t.Fatalf("failed scan made %v", writes)
+			}
+
+			// No drift: the issue is commented on and closed
+			if err := notifier.Notify(ctx, testIssueReport(root, terraform.StatusNoDrift)); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{
+				fmt.Sprintf("POST /issues/%d/%s", first, tt.comment),
+				fmt.Sprintf("%s /issues/%d", tt.update, first),
+			}
+			if writes := s.takeWrites(); !reflect.DeepEqual(writes, want) {
+				t.Fatalf("clean scan made %v, want %v", writes, want)
+			}
+			issue = s.issue(first)
+			if issue.Open || len(issue.Comments) != 1 || !strings.Contains(issue.Comments[0], "no drift") {
+				t.Errorf("issue not closed with a comment: open %t, comments %q", issue.Open, issue.Comments)
+			}
+			for number := 1; number < first; number++ {
+				if !s.issue(number).Open {
+					t.Errorf("issue %d (%s) closed", number, s.issue(number).Title)
+				}
+			}
+
+			// Drift again: a new issue, the closed one is not reopened
+			if err := notifier.Notify(ctx, testIssueReport(root, terraform.StatusDrift, "aws_vpc.main")); err != nil {
+				t.Fatal(err)
+			}
+			if writes := s.takeWrites(); !reflect.DeepEqual(writes, []string{"POST /issues"}) {
+				t.Fatalf("new drift made %v", writes)
+			}
+			if issue := s.issue(first + 1); !issue.Open || issue.Title != "Terraform drift in stacks/network" {
+				t.Errorf("new issue %+v", issue)
+			}
+		})
+	}
+}
+
+func TestIssueNotifierKeepsOldestIssue(t *testing.T) {
+	s, server := newIssueServer(t)
+	body := "<!-- tfdrift:project=stacks/network -->\nstale"
+	s.seed(fakeIssue{Title: "Terraform drift in stacks/network", Body: body, Labels: DefaultIssueLabels})
+	s.seed(fakeIssue{Title: "Terraform drift in stacks/network", Body: body, Labels: DefaultIssueLabels})
+
+	notifier := &IssueNotifier{
+		Tracker: &GitHubIssues{Repository: "acme/infra", Token: "github-token", APIURL: server.URL},
+		Labels:  DefaultIssueLabels,
+	}
+	root := t.TempDir()
+	if err := notifier.Notify(context.Background(), testIssueReport(root, terraform.StatusDrift, "aws_vpc.main")); err != nil {
+		t.Fatal(err)
+	}
+	if writes, want := s.takeWrites(), []string{"PATCH /issues/1"}; !reflect.DeepEqual(writes, want) {
+		t.Errorf("made %v, want %v", writes, want)
+	}
+}
+
+func TestIssueNotifierErrors(t *testing.T) {
+	_, server := newIssueServer(t)
+	notifier := &IssueNotifier{
+		Tracker: &GitHubIssues{Repository: "acme/infra", Token: "wrong", APIURL: server.URL},
+		Labels:  DefaultIssueLabels,
+	}
+	err := notifier.Notify(context.Background(), testIssueReport(t.TempDir(), terraform.StatusDrift, "aws_vpc.main"))
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Notify() = %v, want a 401 error", err)
+	}
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// Projects listed by name in a chat message, the rest are counted.
+const maxListedProjects = 10
+
+// Largest response body read, issue listings carry up to 100 full issue bodies.
+const maxResponseSize = 16 << 20
+
+// Client used by every notifier.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// A destination that is told about a finished scan.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, report *terraform.ScanReport) error
+}
+
+// Implemented by notifiers that need every scan, not only scans with findings.
+type everyScanNotifier interface {
+	EveryScan() bool
+}
+
+// Send the report to every notifier. Unless always is set, a scan without drift or project errors is
+// only sent to notifiers that need every scan. Failures are logged and the first one is returned after
+// every notifier ran.
+func Send(ctx context.Context, report *terraform.ScanReport, notifiers []Notifier, always bool) error {
+	var firstErr error
+	for _, notifier := range notifiers {
+		if !always && !HasFindings(report) {
+			if n, ok := notifier.(everyScanNotifier); !ok || !n.EveryScan() {
+				log.Printf("[Send] No drift or project errors, not notifying %s", notifier.Name())
+				continue
+			}
+		}
+		if err := notifier.Notify(ctx, report); err != nil {
+			log.Errorf("[Send] %s: %s", notifier.Name(), err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", notifier.Name(), err)
+			}
+			continue
+		}
+		log.Printf("[Send] Notified %s", notifier.Name())
+	}
+	return firstErr
+}
+
+// Check whether the scan found drift or failed projects.
+func HasFindings(report *terraform.ScanReport) bool {
+	return report.Totals.Drifted > 0 || report.Totals.Failed > 0
+}
+
+// Link to the CI job that produced the report, for "view report" buttons: the GitHub Actions run or
+// the GitLab job, empty elsewhere.
+func DefaultReportURL() string {
+	if server, repo, run := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"); server != "" && repo != "" && run != "" {
+		return fmt.Sprintf("%s/%s/actions/runs/%s", server, repo, run)
+	}
+	return os.Getenv("CI_JOB_URL")
+}
+
+// One line title of a scan, e.g. "Terraform drift: 2 drifted, 1 failed of 14 projects".
+func Title(report *terraform.ScanReport) string {
+	if !HasFindings(report) {
+		return fmt.Sprintf("Terraform drift: no drift in %d projects", report.Totals.Projects)
+	}
+	return fmt.Sprintf("Terraform drift: %d drifted, %d failed of %d projects", report.Totals.Drifted, report.Totals.Failed, report.Totals.Projects)
+}
+
+// Drifted projects, most changed resources first.
+func DriftedProjects(report *terraform.ScanReport) []*terraform.TerraformService {
+	var drifted []*terraform.TerraformService
+	for _, service := range report.Projects {
+		if service.Status == terraform.StatusDrift {
+			drifted = append(drifted, service)
+		}
+	}
+	sort.SliceStable(drifted, func(i, j int) bool {
+		return changeCount(drifted[i]) > changeCount(drifted[j])
+	})
+	return drifted
+}
+
+// Projects that did not produce a plan.
+func FailedProjects(report *terraform.ScanReport) []*terraform.TerraformService {
+	var failed []*terraform.TerraformService
+	for _, service := range report.Projects {
+		if service.Status.Failed() {
+			failed = append(failed, service)
+		}
+	}
+	return failed
+}
+
+func changeCount(service *terraform.TerraformService) int {
+	return service.CountAdd + service.CountChange + service.CountDestroy + service.CountOutside
+}
+
+// Short form of a project's change counts, e.g. "+1 ~2 -0", or "+0 ~0 -0, 2 changed outside Terraform".
+func changeCounts(service *terraform.TerraformService) string {
+	counts := fmt.Sprintf("+%d ~%d -%d", service.CountAdd, service.CountChange, service.CountDestroy)
+	if service.CountOutside > 0 {
+		counts += fmt.Sprintf(", %d changed outside Terraform", service.CountOutside)
+	}
+	return counts
+}
+
+// Cut s to at most max bytes, marking the cut with an ellipsis.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max - len("…")
+	for cut > 0 && cut < len(s) && (s[cut]&0xC0) == 0x80 {
+		cut--
+	}
+	return s[:cut] + "…"
+}
+
+// POST body as JSON and return the response with its body read. Non-2xx responses are returned
+// without an error so callers can handle rate limits.
+func postJSON(ctx context.Context, url string, headers map[string]string, body interface{}) (*http.Response, []byte, error) {
+	return requestJSON(ctx, http.MethodPost, url, headers, body)
+}
+
+// Send a request with body as JSON (no body when nil) and return the response with its body read,
+// like postJSON.
+func requestJSON(ctx context.Context, method string, url string, headers map[string]string, body interface{}) (*http.Response, []byte, error) {
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	return resp, respBody, err
+}
+
+// Error for an unexpected response, with the start of its body.
+func responseError(resp *http.Response, body []byte) error {
+	return fmt.Errorf("%s: %s", resp.Status, truncate(strings.TrimSpace(string(body)), 300))
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// Opsgenie Alert API, https://api.eu.opsgenie.com for EU accounts.
+const DefaultOpsgenieAPIURL = "https://api.opsgenie.com"
+
+// Opsgenie message and description limits.
+const (
+	opsgenieMessageLimit     = 130
+	opsgenieDescriptionLimit = 15000
+)
+
+// Creates an Opsgenie alert per project that reaches Severity and closes it once a scan finds the
+// project below it. The alert alias is the project's AlertKey, so Opsgenie deduplicates repeated scans.
+type OpsgenieNotifier struct {
+	APIKey    string
+	Severity  string
+	KeyPrefix string
+	ReportURL string
+	// Alert API base URL, DefaultOpsgenieAPIURL when empty.
+	APIURL string
+	// Alerts left open by earlier scans, every clean project's alert is closed when nil.
+	State *AlertState
+}
+
+func (o *OpsgenieNotifier) Name() string {
+	return "opsgenie"
+}
+
+// Clean scans close alerts opened by earlier scans.
+func (o *OpsgenieNotifier) EveryScan() bool {
+	return true
+}
+
+func (o *OpsgenieNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	apiURL := o.APIURL
+	if apiURL == "" {
+		apiURL = DefaultOpsgenieAPIURL
+	}
+	alerts := strings.TrimRight(apiURL, "/") + "/v2/alerts"
+	headers := map[string]string{"Authorization": "GenieKey " + o.APIKey}
+
+	createAlert := func(service *terraform.TerraformService, key string) error {
+		if err := postAlert(ctx, alerts, headers, o.alert(report, service, key)); err != nil {
+			log.Errorf("[OpsgenieNotifier] Unable to create %s: %s", key, err)
+			return fmt.Errorf("create %s: %w", key, err)
+		}
+		return nil
+	}
+	closeAlert := func(key string) error {
+		closeURL := fmt.Sprintf("%s/%s/close?identifierType=alias", alerts, url.PathEscape(key))
+		body := map[string]string{
+			"source": "tfdrift",
+			"note":   "No drift in the latest scan",
+		}
+		// Opsgenie processes requests asynchronously, closing an alias without an open alert is accepted
+		if err := postAlert(ctx, closeURL, headers, body); err != nil {
+			log.Errorf("[OpsgenieNotifier] Unable to close %s: %s", key, err)
+			return fmt.Errorf("close %s: %w", key, err)
+		}
+		return nil
+	}
+	return syncAlerts(o.Name(), report, o.Severity, o.KeyPrefix, o.State, createAlert, closeAlert)
+}
+
+// Create alert request for a project, P1 when resources are destroyed.
+func (o *OpsgenieNotifier) alert(report *terraform.ScanReport, service *terraform.TerraformService, key string) map[string]interface{} {
+	priority := "P3"
+	if service.CountDestroy > 0 {
+		priority = "P1"
+	}
+	description := alertSummary(report, service)
+	var resources []string
+	for _, res := range service.Resources {
+		resources = append(resources, fmt.Sprintf("%s %s", res.Action, res.Address))
+	}
+	if len(resources) > 0 {
+		description += "\n\n" + strings.Join(resources, "\n")
+	}
+	if o.ReportURL != "" {
+		description += "\n\nReport: " + o.ReportURL
+	}
+
+	details := make(map[string]string)
+	for name, value := range alertDetails(report, service, o.ReportURL) {
+		// Opsgenie details are string to string
+		if name != "resources" {
+			details[name] = fmt.Sprint(value)
+		}
+	}
+	return map[string]interface{}{
+		"message":     truncate(alertSummary(report, service), opsgenieMessageLimit),
+		"alias":       key,
+		"description": truncate(description, opsgenieDescriptionLimit),
+		"source":      "tfdrift",
+		"entity":      terraform.DisplayPath(report.RootPath, service),
+		"tags":        []string{"tfdrift", "terraform-drift"},
+		"priority":    priority,
+		"details":     details,
+	}
+}
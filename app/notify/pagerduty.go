@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// PagerDuty Events API v2 endpoint.
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty summary limit.
+const pagerDutySummaryLimit = 1024
+
+// Triggers a PagerDuty incident per project that reaches Severity and resolves it once a scan finds the
+// project below it, through the Events API v2. The dedup key is the project's AlertKey.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	Severity   string
+	KeyPrefix  string
+	ReportURL  string
+	// Events API endpoint, DefaultPagerDutyURL when empty.
+	URL string
+	// Incidents left open by earlier scans, every clean project is resolved when nil.
+	State *AlertState
+}
+
+func (p *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+// Clean scans resolve incidents opened by earlier scans.
+func (p *PagerDutyNotifier) EveryScan() bool {
+	return true
+}
+
+func (p *PagerDutyNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	url := p.URL
+	if url == "" {
+		url = DefaultPagerDutyURL
+	}
+	trigger := func(service *terraform.TerraformService, key string) error {
+		if err := postAlert(ctx, url, nil, p.triggerEvent(report, service)); err != nil {
+			log.Errorf("[PagerDutyNotifier] Unable to trigger %s: %s", key, err)
+			return fmt.Errorf("trigger %s: %w", key, err)
+		}
+		return nil
+	}
+	resolve := func(key string) error {
+		event := map[string]interface{}{
+			"routing_key":  p.RoutingKey,
+			"event_action": "resolve",
+			"dedup_key":    key,
+		}
+		// Resolving a key without an open incident is a no-op for PagerDuty
+		if err := postAlert(ctx, url, nil, event); err != nil {
+			log.Errorf("[PagerDutyNotifier] Unable to resolve %s: %s", key, err)
+			return fmt.Errorf("resolve %s: %w", key, err)
+		}
+		return nil
+	}
+	return syncAlerts(p.Name(), report, p.Severity, p.KeyPrefix, p.State, trigger, resolve)
+}
+
+// Trigger event for a project, critical when resources are destroyed.
+func (p *PagerDutyNotifier) triggerEvent(report *terraform.ScanReport, service *terraform.TerraformService) map[string]interface{} {
+	severity := "warning"
+	if service.CountDestroy > 0 {
+		severity = "critical"
+	}
+	event := map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    AlertKey(p.KeyPrefix, report, service),
+		"client":       "tfdrift",
+		"payload": map[string]interface{}{
+			"summary":        truncate(alertSummary(report, service), pagerDutySummaryLimit),
+			"source":         terraform.DisplayPath(report.RootPath, service),
+			"severity":       severity,
+			"component":      service.ProjectName,
+			"group":          report.RootPath,
+			"class":          "terraform drift",
+			"custom_details": alertDetails(report, service, p.ReportURL),
+		},
+	}
+	if p.ReportURL != "" {
+		event["client_url"] = p.ReportURL
+		event["links"] = []map[string]string{{"href": p.ReportURL, "text": "Drift report"}}
+	}
+	return event
+}
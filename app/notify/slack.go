@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"tfdrift/app/terraform"
+)
+
+// Slack Web API used with a bot token.
+const DefaultSlackAPIURL = "https://slack.com/api"
+
+// Slack limits: section text, header text and button URL.
+const (
+	slackTextLimit   = 3000
+	slackHeaderLimit = 150
+)
+
+// Posts a Block Kit summary to Slack, through an incoming webhook or chat.postMessage with a bot token.
+type SlackNotifier struct {
+	// Incoming webhook URL. Takes precedence over Token.
+	WebhookURL string
+	// Bot token (xoxb-...) and the channel to post to.
+	Token   string
+	Channel string
+	// Link to the report artifact or CI job, shown as a button.
+	ReportURL string
+	// Slack Web API base URL, DefaultSlackAPIURL when empty.
+	APIURL string
+}
+
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Validate the configuration.
+func (s *SlackNotifier) Check() error {
+	if s.WebhookURL == "" && (s.Token == "" || s.Channel == "") {
+		return fmt.Errorf("slack needs a webhook URL, or a bot token and a channel")
+	}
+	return nil
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	if err := s.Check(); err != nil {
+		return err
+	}
+	message := map[string]interface{}{
+		"text":   Title(report),
+		"blocks": SlackBlocks(report, s.ReportURL),
+	}
+
+	if s.WebhookURL != "" {
+		resp, body, err := postJSON(ctx, s.WebhookURL, nil, message)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode/100 != 2 {
+			return responseError(resp, body)
+		}
+		return nil
+	}
+
+	apiURL := s.APIURL
+	if apiURL == "" {
+		apiURL = DefaultSlackAPIURL
+	}
+	message["channel"] = s.Channel
+	resp, body, err := postJSON(ctx, strings.TrimRight(apiURL, "/")+"/chat.postMessage",
+		map[string]string{"Authorization": "Bearer " + s.Token}, message)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, body)
+	}
+	// The Web API reports failures in the body with a 200 status
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("unexpected chat.postMessage response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("chat.postMessage: %s", result.Error)
+	}
+	return nil
+}
+
+// Block Kit message for a scan: totals, the most drifted projects, failed projects and a report button.
+func SlackBlocks(report *terraform.ScanReport, reportURL string) []map[string]interface{} {
+	blocks := []map[string]interface{}{
+		{
+			"type": "header",
+			"text": slackPlainText(truncate(Title(report), slackHeaderLimit)),
+		},
+		{
+			"type": "section",
+			"fields": []map[string]interface{}{
+				slackMarkdown(fmt.Sprintf("*Projects*\n%d", report.Totals.Projects)),
+				slackMarkdown(fmt.Sprintf("*Drifted*\n%d", report.Totals.Drifted)),
+				slackMarkdown(fmt.Sprintf("*Failed*\n%d", report.Totals.Failed)),
+				slackMarkdown(fmt.Sprintf("*No drift*\n%d", report.Totals.NoDrift)),
+			},
+		},
+		{
+			"type": "context",
+			"elements": []map[string]interface{}{
+				slackMarkdown(fmt.Sprintf("`%s` · mode `%s` · %.0fs", slackEscape(report.RootPath), report.Mode, report.DurationSeconds)),
+			},
+		},
+	}
+
+	if drifted := DriftedProjects(report); len(drifted) > 0 {
+		var lines []string
+		for _, service := range drifted {
+			lines = append(lines, fmt.Sprintf("• `%s` %s", slackEscape(terraform.DisplayPath(report.RootPath, service)), changeCounts(service)))
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "divider"},
+			slackSection("*Drifted projects*", lines))
+	}
+	if failed := FailedProjects(report); len(failed) > 0 {
+		var lines []string
+		for _, service := range failed {
+			line := fmt.Sprintf("• `%s` %s", slackEscape(terraform.DisplayPath(report.RootPath, service)), slackEscape(service.Summary))
+			if service.FailedPhase != "" {
+				line += fmt.Sprintf(" (%s)", service.FailedPhase)
+			}
+			lines = append(lines, line)
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "divider"},
+			slackSection("*Failed projects*", lines))
+	}
+
+	if reportURL != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "actions",
+			"elements": []map[string]interface{}{
+				{
+					"type": "button",
+					"text": slackPlainText("View report"),
+					"url":  reportURL,
+				},
+			},
+		})
+	}
+	return blocks
+}
+
+// Section listing at most maxListedProjects lines under a heading, within Slack's text limit.
+func slackSection(heading string, lines []string) map[string]interface{} {
+	more := 0
+	if len(lines) > maxListedProjects {
+		more = len(lines) - maxListedProjects
+		lines = lines[:maxListedProjects]
+	}
+	text := heading + "\n" + strings.Join(lines, "\n")
+	if more > 0 {
+		text += fmt.Sprintf("\n_…and %d more_", more)
+	}
+	return map[string]interface{}{
+		"type": "section",
+		"text": slackMarkdown(truncate(text, slackTextLimit)),
+	}
+}
+
+func slackPlainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text}
+}
+
+func slackMarkdown(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "mrkdwn", "text": text}
+}
+
+// Escape the characters Slack treats as control sequences in mrkdwn.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"tfdrift/app/terraform"
+)
+
+// Adaptive Card schema version supported by Teams on every client.
+const teamsCardVersion = "1.4"
+
+// Projects listed in a collapsed card section, the rest are counted. Teams rejects messages over about 28 KB.
+const teamsListedProjects = 50
+
+// Element ids of the collapsible sections.
+const (
+	teamsDriftedID = "drifted-projects"
+	teamsFailedID  = "failed-projects"
+)
+
+// Posts an Adaptive Card to a Microsoft Teams incoming webhook (Workflows or the legacy connector).
+type TeamsNotifier struct {
+	WebhookURL string
+	// Link to the report artifact or CI job, shown as a button.
+	ReportURL string
+}
+
+func (t *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+func (t *TeamsNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	message := map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     TeamsCard(report, t.ReportURL),
+			},
+		},
+	}
+	resp, body, err := postJSON(ctx, t.WebhookURL, nil, message)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, body)
+	}
+	// The legacy connector reports delivery failures in the body with a 200 status
+	if strings.HasPrefix(string(body), "Webhook message delivery failed") {
+		return fmt.Errorf("%s", truncate(string(body), 300))
+	}
+	return nil
+}
+
+// Adaptive Card for a scan: the totals as facts, the drifted and failed projects in sections the reader
+// can expand, and a button to the report.
+func TeamsCard(report *terraform.ScanReport, reportURL string) map[string]interface{} {
+	body := []map[string]interface{}{
+		{
+			"type":   "TextBlock",
+			"text":   Title(report),
+			"size":   "Large",
+			"weight": "Bolder",
+			"wrap":   true,
+		},
+		{
+			"type":     "TextBlock",
+			"text":     fmt.Sprintf("%s · mode %s · %.0fs", report.RootPath, report.Mode, report.DurationSeconds),
+			"isSubtle": true,
+			"spacing":  "None",
+			"wrap":     true,
+		},
+		teamsFactSet([][2]string{
+			{"Projects", fmt.Sprint(report.Totals.Projects)},
+			{"Drifted", fmt.Sprint(report.Totals.Drifted)},
+			{"Failed", fmt.Sprint(report.Totals.Failed)},
+			{"No drift", fmt.Sprint(report.Totals.NoDrift)},
+		}),
+	}
+	var actions []map[string]interface{}
+
+	if drifted := DriftedProjects(report); len(drifted) > 0 {
+		var facts [][2]string
+		for _, service := range drifted {
+			facts = append(facts, [2]string{terraform.DisplayPath(report.RootPath, service), changeCounts(service)})
+		}
+		body = append(body, teamsSection(teamsDriftedID, "Drifted projects (+add ~change -destroy)", facts))
+		actions = append(actions, teamsToggle(fmt.Sprintf("Drifted projects (%d)", len(drifted)), teamsDriftedID))
+	}
+	if failed := FailedProjects(report); len(failed) > 0 {
+		var facts [][2]string
+		for _, service := range failed {
+			summary := service.Summary
+			if service.FailedPhase != "" {
+				summary += fmt.Sprintf(" (%s)", service.FailedPhase)
+			}
+			facts = append(facts, [2]string{terraform.DisplayPath(report.RootPath, service), summary})
+		}
+		body = append(body, teamsSection(teamsFailedID, "Failed projects", facts))
+		actions = append(actions, teamsToggle(fmt.Sprintf("Failed projects (%d)", len(failed)), teamsFailedID))
+	}
+	if reportURL != "" {
+		actions = append(actions, map[string]interface{}{
+			"type":  "Action.OpenUrl",
+			"title": "View report",
+			"url":   reportURL,
+		})
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": teamsCardVersion,
+		"body":    body,
+		"msteams": map[string]interface{}{"width": "Full"},
+	}
+	if len(actions) > 0 {
+		card["actions"] = actions
+	}
+	return card
+}
+
+// Hidden container listing at most teamsListedProjects facts under a heading.
+func teamsSection(id string, heading string, facts [][2]string) map[string]interface{} {
+	more := 0
+	if len(facts) > teamsListedProjects {
+		more = len(facts) - teamsListedProjects
+		facts = facts[:teamsListedProjects]
+	}
+	items := []map[string]interface{}{
+		{"type": "TextBlock", "text": heading, "weight": "Bolder", "wrap": true},
+		teamsFactSet(facts),
+	}
+	if more > 0 {
+		items = append(items, map[string]interface{}{
+			"type": "TextBlock", "text": fmt.Sprintf("…and %d more", more), "isSubtle": true, "wrap": true,
+		})
+	}
+	return map[string]interface{}{
+		"type":      "Container",
+		"id":        id,
+		"isVisible": false,
+		"separator": true,
+		"items":     items,
+	}
+}
+
+func teamsFactSet(facts [][2]string) map[string]interface{} {
+	var list []map[string]interface{}
+	for _, fact := range facts {
+		list = append(list, map[string]interface{}{"title": fact[0], "value": fact[1]})
+	}
+	return map[string]interface{}{"type": "FactSet", "facts": list}
+}
+
+// Button showing or hiding a section.
+func teamsToggle(title string, id string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":           "Action.ToggleVisibility",
+		"title":          title,
+		"targetElements": []string{id},
+	}
+}
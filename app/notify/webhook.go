@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tfdrift/app/terraform"
+	"tfdrift/log"
+)
+
+// Header carrying the hex HMAC-SHA256 of the request body, prefixed with "sha256=".
+const SignatureHeader = "X-Tfdrift-Signature-256"
+
+// Longest wait between two delivery attempts.
+const maxWebhookBackoff = 30 * time.Second
+
+// POSTs the full JSON scan report (the `--output json` document) to an HTTP endpoint.
+type WebhookNotifier struct {
+	URL string
+	// HMAC-SHA256 key for SignatureHeader, no signature when empty.
+	Secret string
+	// Extra request headers, e.g. Authorization.
+	Headers map[string]string
+	// Retries after a network error, 429 or 5xx response, waiting Backoff, then twice as long each time.
+	Retries int
+	Backoff time.Duration
+	// File the payload is appended to (one JSON object per line) when every attempt failed.
+	DeadLetterFile string
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// The receiving platform ingests every scan, including clean ones.
+func (w *WebhookNotifier) EveryScan() bool {
+	return true
+}
+
+// Parse "Name: value" header flags.
+func ParseHeaders(values []string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, value := range values {
+		name, headerValue, ok := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("header %q is not in the form \"Name: value\"", value)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(headerValue)
+	}
+	return headers, nil
+}
+
+// Compute the SignatureHeader value of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, report *terraform.ScanReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.Backoff
+	// Negative retries still make the first attempt
+	attempts := w.Retries + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+	var lastErr error
+delivery:
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var retry bool
+		retry, lastErr = w.deliver(ctx, payload)
+		if lastErr == nil {
+			return nil
+		}
+		if !retry || attempt == attempts {
+			break
+		}
+		log.Printf("[WebhookNotifier] Attempt %d of %d failed, retrying in %s: %s", attempt, attempts, backoff, lastErr)
+		select {
+		case <-ctx.Done():
+			lastErr = ctx.Err()
+			break delivery
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxWebhookBackoff {
+			backoff = maxWebhookBackoff
+		}
+	}
+
+	if w.DeadLetterFile != "" {
+		if err := w.deadLetter(payload, lastErr); err != nil {
+			log.Errorf("[WebhookNotifier] Unable to write dead letter file %s: %s", w.DeadLetterFile, err)
+		} else {
+			log.Printf("[WebhookNotifier] Saved undelivered report to %s", w.DeadLetterFile)
+		}
+	}
+	return lastErr
+}
+
+// Send the payload once. retry reports whether a later attempt may succeed.
+func (w *WebhookNotifier) deliver(ctx context.Context, payload []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tfdrift")
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, payload))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	switch {
+	case resp.StatusCode/100 == 2:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+		return true, responseError(resp, body)
+	}
+	return false, responseError(resp, body)
+}
+
+// Append an undelivered payload to the dead letter file.
+func (w *WebhookNotifier) deadLetter(payload []byte, deliveryErr error) error {
+	entry := struct {
+		FailedAt time.Time       `json:"failed_at"`
+		URL      string          `json:"url"`
+		Error    string          `json:"error"`
+		Payload  json.RawMessage `json:"payload"`
+	}{
+		FailedAt: time.Now().UTC(),
+		URL:      redactURL(w.URL),
+		Payload:  payload,
+	}
+	if deliveryErr != nil {
+		entry.Error = deliveryErr.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(w.DeadLetterFile); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(w.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// URL without credentials or query string, which may hold tokens.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
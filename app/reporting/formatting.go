@@ -2,21 +2,12 @@ package reporting
 
 import (
 	"encoding/json"
-	"fmt"
 
 	tfjson "github.com/hashicorp/terraform-json"
 
 	"tfdrift/log"
 )
 
-// eventually have stdout template and discord template
-func FormatDriftReport(message string) string {
-	var title string = "Terraform Drift Detection Report"
-	var formattedMessage string = fmt.Sprintf("%s\n```\n%s\n```", title, message)
-	log.Debugf("[FormatDriftReport] Formatted message.\n%s", formattedMessage)
-	return formattedMessage
-}
-
 // Terraform Output
 func FormatTerraformShow(state *tfjson.State) []byte {
 	output, err := json.MarshalIndent(state, "", "\t")
@@ -0,0 +1,128 @@
+package terraform
+
+import (
+	"encoding/csv"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tfdrift/log"
+)
+
+var csvProjectHeader = []string{"project", "path", "terraform_version", "status", "add", "change", "destroy", "changed_outside", "duration_seconds", "failed_phase", "error"}
+
+var csvResourceHeader = []string{"project", "path", "address", "type", "action", "provider", "module", "changed_attributes"}
+
+// Write the report as two delimited tables, one row per project and one row per changed resource of
+// a drifted project. With a path, the tables go to <name>-projects<ext> and <name>-resources<ext>;
+// on stdout they are separated by a blank line. comma is ',' for CSV or '\t' for TSV.
+func WriteDelimitedReport(report *ScanReport, path string, comma rune) error {
+	var projects, resources [][]string
+	projects = append(projects, csvProjectHeader)
+	resources = append(resources, csvResourceHeader)
+	for _, service := range report.Projects {
+		project := DisplayPath(report.RootPath, service)
+		projects = append(projects, []string{
+			service.ProjectName,
+			project,
+			service.TerraformVersion,
+			string(service.Status),
+			strconv.Itoa(service.CountAdd),
+			strconv.Itoa(service.CountChange),
+			strconv.Itoa(service.CountDestroy),
+			strconv.Itoa(service.CountOutside),
+			strconv.FormatFloat(service.DurationSeconds, 'f', 3, 64),
+			service.FailedPhase,
+			service.Error,
+		})
+		if service.Status != StatusDrift {
+			continue
+		}
+		for _, res := range service.Resources {
+			resources = append(resources, []string{
+				service.ProjectName,
+				project,
+				res.Address,
+				res.Type,
+				res.Action,
+				res.Provider,
+				res.ModulePath,
+				strings.Join(res.ChangedAttributes, ";"),
+			})
+		}
+	}
+
+	if path == "" || path == "-" {
+		w, err := CreateOutput(path)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		if err := writeDelimited(w, projects, comma); err != nil {
+			return err
+		}
+		io.WriteString(w, "\n")
+		return writeDelimited(w, resources, comma)
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for _, table := range []struct {
+		path string
+		rows [][]string
+	}{
+		{base + "-projects" + ext, projects},
+		{base + "-resources" + ext, resources},
+	} {
+		w, err := CreateOutput(table.path)
+		if err != nil {
+			return err
+		}
+		if err := writeDelimited(w, table.rows, comma); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		log.Debugf("[WriteDelimitedReport] Wrote %d rows to %s", len(table.rows)-1, table.path)
+	}
+	return nil
+}
+
+// Write rows as CSV, or as TSV when comma is '\t'. TSV cells are joined as is: spreadsheetCell already
+// removed the tabs and line breaks, and CSV quoting would show up as literal quotes.
+func writeDelimited(w io.Writer, rows [][]string, comma rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = spreadsheetCell(cell, comma)
+		}
+		if comma != '\t' {
+			if err := writer.Write(cells); err != nil {
+				return err
+			}
+		} else if _, err := io.WriteString(w, strings.Join(cells, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Keep a value to one cell: TSV has no quoting convention, so tabs and line breaks become spaces,
+// and values a spreadsheet would evaluate as a formula are prefixed with a quote.
+func spreadsheetCell(value string, comma rune) string {
+	if comma == '\t' {
+		value = strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ").Replace(value)
+	}
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			value = "'" + value
+		}
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package terraform
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Scan of /infra with a drifted project and a project failing with a quoted, multi-line error.
+func testDelimitedReport() *ScanReport {
+	drifted := NewProjectService("/infra/stacks/app")
+	drifted.SetStatus(StatusDrift)
+	drifted.SetResources([]ResourceDrift{{
+		Address:           `aws_iam_policy.this["ci"]`,
+		Type:              "aws_iam_policy",
+		Action:            ActionUpdate,
+		ChangedAttributes: []string{"policy", "tags.env"},
+	}})
+	failed := NewProjectService("/infra/stacks/broken")
+	failed.SetFailure(StatusPlanFailed, PhasePlan, errors.New("Error: Invalid value"))
+	failed.Error = "Error: Invalid value for \"region\"\n\ton main.tf"
+	failed.TerraformVersion = "=1.5.7"
+	return NewScanReport("/infra", "test", ModeFull, time.Now(), time.Now(), []*TerraformService{drifted, failed})
+}
+
+func readTable(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteDelimitedReportTSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drift.tsv")
+	if err := WriteDelimitedReport(testDelimitedReport(), path, '\t'); err != nil {
+		t.Fatal(err)
+	}
+
+	projects := strings.Split(strings.TrimSuffix(readTable(t, filepath.Join(filepath.Dir(path), "drift-projects.tsv")), "\n"), "\n")
+	if len(projects) != 3 {
+		t.Fatalf("projects table has %d lines, want a header and 2 rows:\n%s", len(projects), strings.Join(projects, "\n"))
+	}
+	if got, want := projects[0], strings.Join(csvProjectHeader, "\t"); got != want {
+		t.Errorf("header %q, want %q", got, want)
+	}
+	for _, line := range projects {
+		if cells := strings.Split(line, "\t"); len(cells) != len(csvProjectHeader) {
+			t.Errorf("%d cells in %q, want %d", len(cells), line, len(csvProjectHeader))
+		}
+	}
+	broken := strings.Split(projects[2], "\t")
+	// Quotes are kept as is, tabs and line breaks become spaces, formulas are quoted
+	if got, want := broken[len(broken)-1], `Error: Invalid value for "region"  on main.tf`; got != want {
+		t.Errorf("error cell %q, want %q", got, want)
+	}
+	if got := broken[2]; got != "'=1.5.7" {
+		t.Errorf("terraform_version cell %q, want '=1.5.7", got)
+	}
+
+	resources := readTable(t, filepath.Join(filepath.Dir(path), "drift-resources.tsv"))
+	if want := "app\tstacks/app\taws_iam_policy.this[\"ci\"]\taws_iam_policy\tupdate\t\t\tpolicy;tags.env\n"; !strings.HasSuffix(resources, want) {
+		t.Errorf("resources table:\n%s\nwant a last row %q", resources, want)
+	}
+}
+
+func TestWriteDelimitedReportCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drift.csv")
+	if err := WriteDelimitedReport(testDelimitedReport(), path, ','); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(filepath.Dir(path), "drift-projects.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || !reflect.DeepEqual(rows[0], csvProjectHeader) {
+		t.Fatalf("projects table %q", rows)
+	}
+	// CSV quoting keeps the multi-line error in one cell
+	if got, want := rows[2][len(rows[2])-1], "Error: Invalid value for \"region\"\n\ton main.tf"; got != want {
+		t.Errorf("error cell %q, want %q", got, want)
+	}
+}
@@ -1,211 +1,255 @@
 package terraform
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"regexp"
-	"strconv"
 	"strings"
 
+	tfexec "github.com/hashicorp/terraform-exec/tfexec"
 	tfjson "github.com/hashicorp/terraform-json"
-	tail "github.com/hpcloud/tail"
 
 	"tfdrift/log"
 )
 
-// Parse out.tfplan and return the last line if it contains "Plan".
-func GetResourceModificationCount(planFileRawString string, projectName string) (string, error) {
-	var filename string = fmt.Sprintf("/tmp/%s-tmp", projectName)
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Infof("%s", err)
-		panic(err)
-	} else {
-		file.WriteString(planFileRawString)
-	}
-	file.Close()
-	log.Debugf("[GetResourceModificationCount] Opening file: %s", filename)
-
-	var tailLine string = ""
-	t, err := tail.TailFile(filename, tail.Config{Follow: true})
-	for line := range t.Lines {
-		noChanges, _ := regexp.MatchString("\\bNo changes\\b", line.Text)
-		matched, err := regexp.MatchString("\\bPlan\\b", line.Text)
-		if err != nil {
-			panic(err)
-		} else if matched {
-			tailLine = line.Text
-			return tailLine, err
-		} else if noChanges {
-			tailLine = "Plan: 0 to add, 0 to change, 0 to destroy."
-			return tailLine, nil
-		}
+// terraform plan -detailed-exitcode
+// 0 = false (no changes)
+// 1 = Error
+// 2 = true  (drift)
+func GetDriftStatus(exitCode int) Status {
+	log.Debugf("[GetDriftStatus] EXITCODE %d", exitCode)
+	switch exitCode {
+	case 0:
+		return StatusNoDrift
+	case 2:
+		return StatusDrift
+	default:
+		return StatusPlanFailed
 	}
-
-	return tailLine, err
 }
 
-// Get # of Add, Change, Destroy in out.tfplan
-func ParseResourceModificationCount(resourceModificationString string) (map[string]int, error) {
-	var resourceModification map[string]int
-	resourceModification = make(map[string]int)
-
-	re := regexp.MustCompile("[0-9]+")
-	var counts []string = re.FindAllString(resourceModificationString, -1)
-
-	countAdd, err := strconv.Atoi(counts[0])
-	if err != nil {
-		panic(err)
-	}
-	countChange, err := strconv.Atoi(counts[1])
-	if err != nil {
-		panic(err)
-	}
-	countDestroy, err := strconv.Atoi(counts[2])
-	if err != nil {
-		panic(err)
+// Create the TerraformService for a project before anything has run.
+func NewProjectService(absProjectPath string) *TerraformService {
+	_, projectName := GetProjectName(absProjectPath)
+	return &TerraformService{
+		ProjectName: projectName,
+		ProjectPath: absProjectPath,
+		Resources:   []ResourceDrift{},
 	}
+}
 
-	resourceModification["CountAdd"] = countAdd
-	resourceModification["CountChange"] = countChange
-	resourceModification["CountDestroy"] = countDestroy
+// Record the outcome of a project scan.
+func (tfs *TerraformService) SetStatus(status Status) {
+	tfs.Status = status
+	tfs.Summary = status.Description()
+}
 
-	return resourceModification, err
+// Record a failed phase with its (trimmed) error.
+func (tfs *TerraformService) SetFailure(status Status, phase string, err error) {
+	tfs.SetStatus(status)
+	tfs.FailedPhase = phase
+	tfs.Error = TrimError(err)
+	log.Errorf("[DriftReport] %s failed during %s: %s", tfs.ProjectName, phase, tfs.Error)
 }
 
-// terraform plan -detailed-exitcode
-// 0 = false (no changes)
-// 1 = Error
-// 2 = true  (drift)
-func GetDriftSummary(exitCode int, planErr error, state *tfjson.State, project string) string {
-	var message string
-	log.Debugf("[GetDriftSummary] EXITCODE %d", exitCode)
-	if exitCode == 2 {
-		message = "Drift detected for Plan."
-		log.Debugf("[GetDriftSummary] %s", message)
-	} else if exitCode == 0 {
-		message = "No changes."
-		log.Debugf("[GetDriftSummary] %s", message)
-	} else if exitCode == 1 {
-		message = "Failed to run tfxec on project: " + project
-		log.Debugf("[GetDriftSummary] %s", message)
+// Report a project whose scan was stopped by a timeout or cancellation during phase.
+// An empty phase means the project never started.
+func InterruptedService(ctx context.Context, absProjectPath string, phase string) *TerraformService {
+	tfs := NewProjectService(absProjectPath)
+	if phase == "" {
+		tfs.SetStatus(StatusSkipped)
 	} else {
-		message = fmt.Sprintf("Improper exit code of %s returned.", exitCode)
-		log.Debugf("[GetDriftSummary] %s", message)
+		tfs.SetStatus(interruptedStatus(ctx))
+		tfs.FailedPhase = phase
+		tfs.Error = TrimError(ctx.Err())
 	}
-	return message
+	log.Warnf("[DriftReport] %s %s", tfs.ProjectName, tfs.Summary)
+	return tfs
 }
 
-// Populate a TerraformService structure with relevant data.
-func UpdateDriftReportData(state *tfjson.State, projectName string, counts map[string]int, summary string) *TerraformService {
-	tfs := &TerraformService{
-		//State:            state,
-		ProjectName:      projectName,
-		TerraformVersion: state.TerraformVersion,
-		CountAdd:         counts["CountAdd"],
-		CountChange:      counts["CountChange"],
-		CountDestroy:     counts["CountDestroy"],
-		Summary:          summary,
+// Fill in the resource changes and the counts derived from them. The resources of a refresh-only
+// scan were changed outside of Terraform and are only counted by SetOutsideChanges.
+func (tfs *TerraformService) SetResources(resources []ResourceDrift) {
+	tfs.CountAdd, tfs.CountChange, tfs.CountDestroy = 0, 0, 0
+	if tfs.Mode != ModeRefreshOnly {
+		tfs.CountAdd, tfs.CountChange, tfs.CountDestroy = CountResourceChanges(resources)
 	}
-	return tfs
+	tfs.Resources = resources
+}
+
+// Fill in the objects changed outside of Terraform and their count.
+func (tfs *TerraformService) SetOutsideChanges(outside []ResourceDrift) {
+	tfs.OutsideChanges = outside
+	tfs.CountOutside = len(outside)
 }
 
 // The function that actually counts the most.
-func DriftReport(absProjectPath string, backendConfig string, terraformVersion string) *TerraformService {
-	// Pre-Init
-	CleanupCachedFiles(absProjectPath)
+func DriftReport(ctx context.Context, absProjectPath string, opts ScanOptions) *TerraformService {
+	return DriftReportIn(ctx, absProjectPath, absProjectPath, opts)
+}
+
+// Run DriftReport in absProjectPath, a copy of projectPath (see Workspace). The Terraform version is
+// selected from projectPath, so .terraform-version and .tool-versions files above the copied
+// directory still apply.
+func DriftReportIn(ctx context.Context, projectPath string, absProjectPath string, opts ScanOptions) *TerraformService {
+	tfService := NewProjectService(absProjectPath)
+	project := absProjectPath
+	projectName := tfService.ProjectName
+
+	if opts.ProjectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ProjectTimeout)
+		defer cancel()
+	}
+
+	// Pre-Init. An isolated copy has no .terraform directory and keeps the lock file, so providers
+	// are the versions the project pinned.
+	if !opts.Isolate {
+		CleanupCachedFiles(absProjectPath)
+	}
 
 	// tfexec Setup
-	service := ConfigureTerraform(absProjectPath, terraformVersion)
-	_, projectName := GetProjectName(absProjectPath)
-	// terraform init
-	project, failedProject, err := Init(service, backendConfig)
+	terraformVersion, versionSource := SelectTerraformVersion(ctx, projectPath, opts)
+	tfService.TerraformVersion = terraformVersion
+	tfService.TerraformVersionSource = versionSource
+	tfService.Mode = opts.Mode
+	log.Infof("[DriftReport] Using terraform %s (%s) for project: %s", terraformVersion, versionSource, absProjectPath)
+	service, err := ConfigureTerraform(ctx, absProjectPath, opts.Binaries, terraformVersion)
+	if ctx.Err() != nil {
+		return InterruptedService(ctx, absProjectPath, PhaseInstall)
+	}
 	if err != nil {
-		log.Infof("[DriftReport] Failed project: %s", project)
-	}
-
-	var tfService *TerraformService = &TerraformService{}
-
-	if !failedProject {
-		// terraform show
-		state := Show(service)
-		// terraform plan (-detailed-exitcode)
-		exitCode, planErr := Plan(service, projectName)
-
-		// terraform plan (-out=out.tfplan)
-		planPath := fmt.Sprintf("%s/%s.tfplan", absProjectPath, projectName)
-
-		var rawPlan, showPlanErr = ShowPlanFileRaw(service, planPath)
-		log.Debugf("[DriftReport] Retrieved rawPlan for project: %s", project)
-
-		// If no rawPlan is able to be found, skip this and set ResourceMod count to 0,0,0 :'(
-		var resourceCount map[string]int = map[string]int{"CountAdd": 0, "CountChange": 0, "CountDestroy": 0}
-		if rawPlan != "" {
-			planString, err := GetResourceModificationCount(rawPlan, projectName)
-			if err != nil {
-				panic(err)
-			}
-			log.Infof("[DriftReport] Retrieved resource count for project: %s.", project)
-
-			// If drift detected in Plan return the Add/Change/Destroy count values.
-			modifiedResourceCount, err := ParseResourceModificationCount(planString)
-			if err != nil {
-				panic(err)
-			}
-			log.Infof("[DriftReport] Parsing rawPlan to get modified resource count for project: %s.", project)
-			resourceCount = modifiedResourceCount
-		}
+		tfService.SetFailure(StatusInitFailed, PhaseInstall, err)
+		return tfService
+	}
 
-		// Determine error
-		var terraformError error
-		if planErr == nil && showPlanErr != nil {
-			terraformError = showPlanErr
-			log.Debugf("[DriftReport] Error for %s is %s", project, terraformError)
-		} else {
-			terraformError = planErr
-			log.Debugf("[DriftReport] Error for %s is %s", project, terraformError)
+	// terraform init
+	_, failedProject, err := Init(ctx, service, opts)
+	if ctx.Err() != nil {
+		return InterruptedService(ctx, absProjectPath, PhaseInit)
+	}
+	if failedProject {
+		tfService.SetFailure(StatusInitFailed, PhaseInit, err)
+		return tfService
+	}
+
+	// terraform show
+	if _, err := Show(ctx, service); err != nil {
+		if ctx.Err() != nil {
+			return InterruptedService(ctx, absProjectPath, PhaseShow)
 		}
+		tfService.SetFailure(StatusShowFailed, PhaseShow, err)
+		return tfService
+	}
 
-		// Get project name + status information
-		summary := GetDriftSummary(exitCode, terraformError, state, project)
-		log.Debugf("[DriftReport] Getting Drift Summary for %s", project)
+	// terraform plan (-detailed-exitcode), once per requested mode
+	var full, refresh planResult
+	if opts.Mode != ModeRefreshOnly {
+		full = runPlan(ctx, service, absProjectPath, projectName)
+	}
+	if opts.Mode == ModeRefreshOnly || opts.Mode == ModeBoth {
+		refresh = runPlan(ctx, service, absProjectPath, projectName+".refresh-only", tfexec.RefreshOnly(true))
+	}
+	if ctx.Err() != nil {
+		return InterruptedService(ctx, absProjectPath, PhasePlan)
+	}
 
-		// Format a TerraformService structure with all information needed for the Drift Report
-		tfService := UpdateDriftReportData(state, projectName, resourceCount, summary)
-		log.Debugf("[DriftReport] Returning Terraform Service for %s", project)
+	var main planResult
+	var resources, outside, pending []ResourceDrift
+	switch opts.Mode {
+	case ModeRefreshOnly:
+		main = refresh
+		resources = OutsideChanges(refresh.Plan)
+		outside = resources
+	case ModeBoth:
+		main = full
+		main.ExitCode = combineExitCodes(full.ExitCode, refresh.ExitCode)
+		if main.Err == nil {
+			main.Err, main.ErrPhase = refresh.Err, refresh.ErrPhase
+		}
+		resources = ResourceChanges(full.Plan)
+		outside = OutsideChanges(refresh.Plan)
+		pending = PendingChanges(resources, outside)
+	default:
+		main = full
+		resources = ResourceChanges(full.Plan)
+		outside = OutsideChanges(full.Plan)
+	}
+	log.Debugf("[DriftReport] Found %d changed resources for project: %s", len(resources), project)
+
+	// Format a TerraformService structure with all information needed for the Drift Report
+	tfService.PlanFile = main.PlanPath
+	tfService.PlanOutput = main.Raw
+	if main.Err != nil {
+		if main.ErrPhase == PhaseShow {
+			tfService.SetFailure(StatusShowFailed, PhaseShow, main.Err)
+		} else {
+			tfService.SetFailure(StatusPlanFailed, PhasePlan, main.Err)
+		}
 		return tfService
 	}
-
+	tfService.SetStatus(GetDriftStatus(main.ExitCode))
+	if resources != nil {
+		tfService.SetResources(resources)
+	}
+	tfService.SetOutsideChanges(outside)
+	tfService.PendingChanges = pending
+	log.Debugf("[DriftReport] Returning Terraform Service for %s", project)
 	return tfService
 }
 
-func GeneratePlan(absProjectPath string, backendConfig string, terraformVersion string) *TerraformService {
-	service := ConfigureTerraform(absProjectPath, terraformVersion)
-	// terraform init
-	var tfService *TerraformService = &TerraformService{}
+// Outcome of one `terraform plan` and the `terraform show` calls reading it back.
+type planResult struct {
+	ExitCode int
+	Err      error
+	ErrPhase string
+	PlanPath string
+	Plan     *tfjson.Plan
+	Raw      string
+}
 
-	_, projectName := GetProjectName(absProjectPath)
-	project, failedProject, err := Init(service, backendConfig)
-	if err != nil {
-		log.Infof("[DriftReport] Failed project: %s", project)
+// Run `terraform plan -out=<outputName>.tfplan` and load the saved plan as JSON and as text.
+// Plan errors take precedence over errors reading the plan back.
+func runPlan(ctx context.Context, service *tfexec.Terraform, absProjectPath string, outputName string, opts ...tfexec.PlanOption) planResult {
+	var result planResult
+	result.ExitCode, result.Err = Plan(ctx, service, outputName, opts...)
+	result.PlanPath = fmt.Sprintf("%s/%s.tfplan", absProjectPath, outputName)
+	if ctx.Err() != nil {
+		// Don't leave a half-written plan behind
+		os.Remove(result.PlanPath)
+		result.Err, result.ErrPhase = ctx.Err(), PhasePlan
+		return result
+	}
+	if result.Err != nil {
+		result.ErrPhase = PhasePlan
+		return result
 	}
-	log.Infof("Generating plan for %s", projectName)
 
-	if !failedProject {
-		// terraform show
-		Show(service)
-		// terraform plan (-detailed-exitcode)
-		_, planErr := Plan(service, projectName)
+	// terraform show -json out.tfplan
+	plan, showPlanErr := ShowPlanFile(ctx, service, result.PlanPath)
+	result.Plan = plan
+	if showPlanErr != nil {
+		result.Err, result.ErrPhase = showPlanErr, PhaseShow
+	}
 
-		var terraformError error
-		if planErr != nil {
-			terraformError = planErr
-			log.Debugf("[DriftReport] Error for %s is %s", project, terraformError)
-		}
-		return tfService
+	// Human readable plan, kept for the reports
+	raw, rawPlanErr := ShowPlanFileRaw(ctx, service, result.PlanPath)
+	if rawPlanErr != nil {
+		log.Debugf("[runPlan] Unable to render plan %s: %s", result.PlanPath, rawPlanErr)
 	}
-	log.Infof("Finished Generating Plan")
-	return tfService
+	result.Raw = raw
+	return result
+}
+
+// Merge the detailed exit codes of two plans: any error wins, then any drift.
+func combineExitCodes(a int, b int) int {
+	if a == 1 || b == 1 {
+		return 1
+	}
+	if a == 2 || b == 2 {
+		return 2
+	}
+	return 0
 }
 
 func TerraformPlanTrim(s string) string {
@@ -214,19 +258,3 @@ func TerraformPlanTrim(s string) string {
 	}
 	return s
 }
-
-// Go channel which returns the result of a DriftReport (required to parallelize)
-func GetProjectDrift(ch chan *TerraformService, absProjectPath string, backendConfig string, terraformVersion string) {
-	log.Printf("[GetDriftReport] Getting values for project: %s", absProjectPath)
-	ch <- DriftReport(absProjectPath, backendConfig, terraformVersion)
-}
-
-// func GetDiff(ch chan *TerraformService, absProjectPath string, providerName string, backendConfig string) {
-// 	log.Printf("[GetDriftDiff] Getting values for project: %s", absProjectPath)
-// 	ch <- GetPlanDiff(absProjectPath, providerName, backendConfig)
-// }
-
-func GetPlan(ch chan *TerraformService, absProjectPath string, backendConfig string, terraformVersion string) {
-	log.Printf("[GetDriftDiff] Getting values for project: %s", absProjectPath)
-	ch <- GeneratePlan(absProjectPath, backendConfig, terraformVersion)
-}
@@ -0,0 +1,71 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exit codes of `tfdrift scan`.
+const (
+	// No drift and no project errors, or nothing matched the --fail-on policy.
+	ExitClean = 0
+	// tfdrift itself failed: bad flags, unreadable scan path, unexpected panic.
+	ExitToolFailure = 1
+	// At least one project drifted (or planned a destroy with --fail-on destroy).
+	ExitDrift = 2
+	// At least one project failed, timed out, was cancelled or skipped. Takes precedence over ExitDrift
+	// because the results are incomplete.
+	ExitProjectErrors = 3
+)
+
+// Which scan outcomes make `tfdrift scan` exit non-zero.
+type FailPolicy struct {
+	Drift   bool
+	Error   bool
+	Destroy bool
+}
+
+// Parse a comma separated --fail-on value: drift, error, destroy or none.
+func ParseFailPolicy(value string) (FailPolicy, error) {
+	var policy FailPolicy
+	for _, item := range strings.Split(value, ",") {
+		switch strings.TrimSpace(item) {
+		case "drift":
+			policy.Drift = true
+		case "error":
+			policy.Error = true
+		case "destroy":
+			policy.Destroy = true
+		case "none", "":
+		default:
+			return policy, fmt.Errorf("--fail-on %q not supported (drift, error, destroy, none)", item)
+		}
+	}
+	return policy, nil
+}
+
+// Exit code for a finished scan under the given policy.
+func ScanExitCode(tsArray []*TerraformService, policy FailPolicy) int {
+	var drifted, failed, destroys bool
+	for _, service := range tsArray {
+		if service.Status.Failed() {
+			failed = true
+		}
+		if service.Status == StatusDrift {
+			drifted = true
+			if service.CountDestroy > 0 {
+				destroys = true
+			}
+		}
+	}
+
+	switch {
+	case policy.Error && failed:
+		return ExitProjectErrors
+	case policy.Drift && drifted:
+		return ExitDrift
+	case policy.Destroy && destroys:
+		return ExitDrift
+	}
+	return ExitClean
+}
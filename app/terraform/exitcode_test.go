@@ -0,0 +1,144 @@
+package terraform
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseFailPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    FailPolicy
+		wantErr bool
+	}{
+		{value: "drift,error", want: FailPolicy{Drift: true, Error: true}},
+		{value: "drift", want: FailPolicy{Drift: true}},
+		{value: "error", want: FailPolicy{Error: true}},
+		{value: "destroy", want: FailPolicy{Destroy: true}},
+		{value: " destroy , error ", want: FailPolicy{Error: true, Destroy: true}},
+		{value: "drift,error,destroy", want: FailPolicy{Drift: true, Error: true, Destroy: true}},
+		{value: "none", want: FailPolicy{}},
+		{value: "", want: FailPolicy{}},
+		{value: "drifts", wantErr: true},
+		{value: "drift,all", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseFailPolicy(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseFailPolicy(%q) = %+v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseFailPolicy(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// A scanned project with the given status, planning destroy deletions.
+func exitCodeService(status Status, destroy int) *TerraformService {
+	service := NewProjectService("/infra/" + string(status))
+	service.SetStatus(status)
+	service.CountDestroy = destroy
+	return service
+}
+
+func TestScanExitCode(t *testing.T) {
+	policies := []string{"none", "drift", "error", "destroy", "drift,error", "error,destroy"}
+	tests := []struct {
+		name     string
+		services []*TerraformService
+		// Exit code under each of policies
+		want []int
+	}{
+		{
+			name:     "no projects",
+			services: nil,
+			want:     []int{0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:     "no drift",
+			services: []*TerraformService{exitCodeService(StatusNoDrift, 0)},
+			want:     []int{0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:     "drift",
+			services: []*TerraformService{exitCodeService(StatusNoDrift, 0), exitCodeService(StatusDrift, 0)},
+			want:     []int{0, 2, 0, 0, 2, 0},
+		},
+		{
+			name:     "drift with a destroy",
+			services: []*TerraformService{exitCodeService(StatusDrift, 1)},
+			want:     []int{0, 2, 0, 2, 2, 2},
+		},
+		{
+			name:     "errors take precedence over drift",
+			services: []*TerraformService{exitCodeService(StatusDrift, 1), exitCodeService(StatusPlanFailed, 0)},
+			want:     []int{0, 2, 3, 2, 3, 3},
+		},
+	}
+	for _, status := range []Status{
+		StatusInitFailed, StatusPlanFailed, StatusShowFailed,
+		StatusSkipped, StatusTimedOut, StatusCancelled, StatusInternalError,
+	} {
+		tests = append(tests, struct {
+			name     string
+			services []*TerraformService
+			want     []int
+		}{
+			name:     string(status),
+			services: []*TerraformService{exitCodeService(StatusNoDrift, 0), exitCodeService(status, 0)},
+			want:     []int{0, 0, 3, 0, 3, 3},
+		})
+	}
+
+	for _, tt := range tests {
+		for i, value := range policies {
+			t.Run(fmt.Sprintf("%s/%s", tt.name, value), func(t *testing.T) {
+				policy, err := ParseFailPolicy(value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ScanExitCode(tt.services, policy); got != tt.want[i] {
+					t.Errorf("ScanExitCode(--fail-on %s) = %d, want %d", value, got, tt.want[i])
+				}
+			})
+		}
+	}
+}
+
+func TestScanExitCodeIgnoresDestroysOfFailedProjects(t *testing.T) {
+	// Counts left over from a failed plan are not a planned destroy
+	service := exitCodeService(StatusPlanFailed, 2)
+	if got := ScanExitCode([]*TerraformService{service}, FailPolicy{Destroy: true}); got != ExitClean {
+		t.Errorf("ScanExitCode() = %d, want %d", got, ExitClean)
+	}
+}
+
+func TestScanExitCodeIgnoresChangesOutsideTerraform(t *testing.T) {
+	// An object deleted outside of Terraform is drift, not a planned destroy
+	service := NewProjectService("/infra/refresh-only")
+	service.Mode = ModeRefreshOnly
+	service.SetStatus(StatusDrift)
+	deleted := []ResourceDrift{{Address: "aws_instance.gone", Action: ActionDelete}}
+	service.SetResources(deleted)
+	service.SetOutsideChanges(deleted)
+	if service.CountAdd != 0 || service.CountChange != 0 || service.CountDestroy != 0 || service.CountOutside != 1 {
+		t.Errorf("counts +%d ~%d -%d, %d changed outside, want only 1 changed outside",
+			service.CountAdd, service.CountChange, service.CountDestroy, service.CountOutside)
+	}
+	services := []*TerraformService{service}
+	if got := ScanExitCode(services, FailPolicy{Destroy: true}); got != ExitClean {
+		t.Errorf("ScanExitCode(--fail-on destroy) = %d, want %d", got, ExitClean)
+	}
+	if got := ScanExitCode(services, FailPolicy{Drift: true}); got != ExitDrift {
+		t.Errorf("ScanExitCode(--fail-on drift) = %d, want %d", got, ExitDrift)
+	}
+	if got := ResourceSummary(service); got != "Plan: 0 to add, 0 to change, 0 to destroy. 1 changed outside Terraform." {
+		t.Errorf("ResourceSummary() = %q", got)
+	}
+}
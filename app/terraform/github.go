@@ -0,0 +1,130 @@
+package terraform
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tfdrift/log"
+)
+
+// Values of --github-actions.
+const (
+	GitHubAuto   = "auto"
+	GitHubAlways = "always"
+	GitHubNever  = "never"
+)
+
+// GitHub shows at most 10 annotations of each level (error, warning) per step, more only add noise to the log.
+const maxGitHubAnnotations = 10
+
+// GitHub rejects job summaries over 1 MiB.
+const githubSummaryLimit = 1024*1024 - 1024
+
+// Check whether the GitHub Actions integration should run for a --github-actions value.
+func GitHubActionsEnabled(setting string) (bool, error) {
+	switch setting {
+	case GitHubAuto:
+		return os.Getenv("GITHUB_ACTIONS") == "true", nil
+	case GitHubAlways:
+		return true, nil
+	case GitHubNever:
+		return false, nil
+	}
+	return false, fmt.Errorf("--github-actions %q not supported (%s, %s, %s)", setting, GitHubAuto, GitHubAlways, GitHubNever)
+}
+
+// Report the scan to GitHub Actions: a warning annotation on the declaring block of every changed
+// resource and an error annotation for every failed project (written to w, stderr in practice, so
+// stdout stays free for reports), the Markdown report appended to $GITHUB_STEP_SUMMARY and the
+// drift_count and failed_count step outputs appended to $GITHUB_OUTPUT.
+func WriteGitHubActions(report *ScanReport, w io.Writer) error {
+	workspace := os.Getenv("GITHUB_WORKSPACE")
+	if workspace == "" {
+		workspace, _ = os.Getwd()
+	}
+
+	errorCount, warningCount := 0, 0
+	locator := NewResourceLocator()
+	for _, service := range report.Projects {
+		project := DisplayPath(report.RootPath, service)
+		if service.Status.Failed() {
+			if errorCount < maxGitHubAnnotations {
+				fmt.Fprintf(w, "::error title=%s::%s\n",
+					githubProperty("tfdrift: "+project), githubData(strings.TrimSpace(service.Summary+"\n"+service.Error)))
+			}
+			errorCount++
+			continue
+		}
+		if service.Status != StatusDrift {
+			continue
+		}
+		for _, res := range service.Resources {
+			if warningCount < maxGitHubAnnotations {
+				properties := "title=" + githubProperty(fmt.Sprintf("Drift: %s %s", res.Action, res.Address))
+				if location, ok := locator.Locate(service.ProjectPath, res); ok {
+					properties = fmt.Sprintf("file=%s,line=%d,endLine=%d,%s",
+						githubProperty(workspacePath(workspace, location.File)), location.StartLine, location.EndLine, properties)
+				}
+				fmt.Fprintf(w, "::warning %s::%s\n", properties, githubData(sarifResultMessage(project, res)))
+			}
+			warningCount++
+		}
+	}
+	if errorCount > maxGitHubAnnotations || warningCount > maxGitHubAnnotations {
+		log.Printf("[WriteGitHubActions] Emitted at most %d annotations of each level, out of %d errors and %d warnings",
+			maxGitHubAnnotations, errorCount, warningCount)
+	}
+
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		if err := appendFile(path, RenderMarkdown(report, githubSummaryLimit)); err != nil {
+			return fmt.Errorf("writing job summary: %w", err)
+		}
+	}
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		outputs := fmt.Sprintf("drift_count=%d\nfailed_count=%d\n", report.Totals.Drifted, report.Totals.Failed)
+		if err := appendFile(path, outputs); err != nil {
+			return fmt.Errorf("writing step outputs: %w", err)
+		}
+	}
+	log.Debugf("[WriteGitHubActions] Reported %d drifted and %d failed projects to GitHub Actions", report.Totals.Drifted, report.Totals.Failed)
+	return nil
+}
+
+func appendFile(path string, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Path of file relative to dir when it is inside it, the absolute path otherwise.
+func workspacePath(dir string, file string) string {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	if dir != "" && isWithin(dir, absFile) {
+		if rel, err := filepath.Rel(dir, absFile); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(absFile)
+}
+
+// Escape the message of a workflow command.
+func githubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// Escape a property value of a workflow command.
+func githubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,46 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteGitHubActionsAnnotationLimit(t *testing.T) {
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	t.Setenv("GITHUB_OUTPUT", "")
+	t.Setenv("GITHUB_WORKSPACE", "/infra")
+
+	var services []*TerraformService
+	for i := 0; i < 3; i++ {
+		service := NewProjectService(fmt.Sprintf("/infra/drifted-%d", i))
+		service.SetStatus(StatusDrift)
+		var resources []ResourceDrift
+		for r := 0; r < 5; r++ {
+			resources = append(resources, ResourceDrift{Address: fmt.Sprintf("aws_instance.web[%d]", r), Type: "aws_instance", Name: "web", Action: ActionUpdate})
+		}
+		service.SetResources(resources)
+		services = append(services, service)
+	}
+	for i := 0; i < 12; i++ {
+		service := NewProjectService(fmt.Sprintf("/infra/failed-%02d", i))
+		service.SetFailure(StatusInitFailed, PhaseInit, fmt.Errorf("Error: Failed to query available provider packages"))
+		services = append(services, service)
+	}
+	// The first failed project comes before the drifted ones
+	services = append(services[len(services)-1:], services[:len(services)-1]...)
+	report := NewScanReport("/infra", "test", ModeFull, time.Now(), time.Now(), services)
+
+	var out strings.Builder
+	if err := WriteGitHubActions(report, &out); err != nil {
+		t.Fatal(err)
+	}
+	// Each level has its own limit, failed projects do not use up the warnings
+	if got := strings.Count(out.String(), "::warning "); got != maxGitHubAnnotations {
+		t.Errorf("%d warning annotations, want %d", got, maxGitHubAnnotations)
+	}
+	if got := strings.Count(out.String(), "::error "); got != maxGitHubAnnotations {
+		t.Errorf("%d error annotations, want %d", got, maxGitHubAnnotations)
+	}
+}
@@ -0,0 +1,304 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+
+	"tfdrift/log"
+)
+
+// Top-level blocks tfdrift reads from a project's configuration.
+var rootSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+		{Type: "module", LabelNames: []string{"name"}},
+		{Type: "resource", LabelNames: []string{"type", "name"}},
+		{Type: "data", LabelNames: []string{"type", "name"}},
+	},
+}
+
+// Attributes tfdrift reads from a `terraform {}` block.
+var terraformBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "required_version"},
+	},
+}
+
+// Attributes tfdrift reads from a `module "name" {}` block.
+var moduleBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "source"},
+	},
+}
+
+// Parse every *.tf and *.tf.json file directly inside projectPath.
+// Files that fail to parse are logged and skipped.
+func parseProjectFiles(projectPath string) ([]*hcl.File, error) {
+	entries, err := os.ReadDir(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := hclparse.NewParser()
+	var files []*hcl.File
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		filename := filepath.Join(projectPath, entry.Name())
+
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		switch {
+		case strings.HasSuffix(entry.Name(), ".tf"):
+			file, diags = parser.ParseHCLFile(filename)
+		case strings.HasSuffix(entry.Name(), ".tf.json"):
+			file, diags = parser.ParseJSONFile(filename)
+		default:
+			continue
+		}
+		if diags.HasErrors() {
+			log.Debugf("[parseProjectFiles] Skipping %s: %s", filename, diags.Error())
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// Return every `required_version` constraint declared in the project's `terraform {}` blocks.
+func RequiredVersions(projectPath string) ([]string, error) {
+	files, err := parseProjectFiles(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var constraints []string
+	for _, file := range files {
+		content, _, _ := file.Body.PartialContent(rootSchema)
+		for _, block := range content.Blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			blockContent, _, _ := block.Body.PartialContent(terraformBlockSchema)
+			attr, ok := blockContent.Attributes["required_version"]
+			if !ok {
+				continue
+			}
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+				log.Debugf("[RequiredVersions] Ignoring non-literal required_version in %s", attr.Range.Filename)
+				continue
+			}
+			constraints = append(constraints, value.AsString())
+		}
+	}
+	return constraints, nil
+}
+
+// Return the absolute directories of every local module (source "./..." or "../...") the project
+// calls, including modules called by those modules.
+func LocalModuleDirs(projectPath string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	var walk func(dir string)
+	walk = func(dir string) {
+		files, err := parseProjectFiles(dir)
+		if err != nil {
+			log.Debugf("[LocalModuleDirs] Unable to read %s: %s", dir, err)
+			return
+		}
+		for _, file := range files {
+			content, _, _ := file.Body.PartialContent(rootSchema)
+			for _, block := range content.Blocks {
+				if block.Type != "module" {
+					continue
+				}
+				moduleDir, ok := localModuleDir(dir, block)
+				if !ok {
+					continue
+				}
+				if seen[moduleDir] {
+					continue
+				}
+				seen[moduleDir] = true
+				dirs = append(dirs, moduleDir)
+				walk(moduleDir)
+			}
+		}
+	}
+
+	absPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return nil
+	}
+	walk(absPath)
+	return dirs
+}
+
+// Directory of a module block's source when it is local ("./..." or "../...").
+func localModuleDir(dir string, block *hcl.Block) (string, bool) {
+	blockContent, _, _ := block.Body.PartialContent(moduleBlockSchema)
+	attr, ok := blockContent.Attributes["source"]
+	if !ok {
+		return "", false
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+		return "", false
+	}
+	source := value.AsString()
+	if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+		return "", false
+	}
+	return filepath.Clean(filepath.Join(dir, source)), true
+}
+
+// Where a block is declared in a project's configuration.
+type SourceLocation struct {
+	File      string
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+}
+
+func sourceLocation(r hcl.Range) SourceLocation {
+	return SourceLocation{
+		File:      r.Filename,
+		StartLine: r.Start.Line,
+		StartCol:  r.Start.Column,
+		EndLine:   r.End.Line,
+		EndCol:    r.End.Column,
+	}
+}
+
+// Declarations found in one configuration directory.
+type configIndex struct {
+	// "resource.TYPE.NAME", "data.TYPE.NAME" or "module.NAME" to the block header.
+	blocks map[string]hcl.Range
+	// Module name to its directory, for local module sources only.
+	localModules map[string]string
+	// First configuration file, used when nothing more specific is found.
+	firstFile string
+}
+
+// Finds where the resources of a plan are declared, following local module calls.
+// Parsed directories are cached, so one locator should be reused for every resource of a scan.
+type ResourceLocator struct {
+	indexes map[string]*configIndex
+}
+
+func NewResourceLocator() *ResourceLocator {
+	return &ResourceLocator{indexes: make(map[string]*configIndex)}
+}
+
+func (l *ResourceLocator) index(dir string) *configIndex {
+	if idx, ok := l.indexes[dir]; ok {
+		return idx
+	}
+	idx := &configIndex{blocks: make(map[string]hcl.Range), localModules: make(map[string]string)}
+	l.indexes[dir] = idx
+
+	files, err := parseProjectFiles(dir)
+	if err != nil {
+		log.Debugf("[ResourceLocator] Unable to read %s: %s", dir, err)
+		return idx
+	}
+	for _, file := range files {
+		content, _, _ := file.Body.PartialContent(rootSchema)
+		for _, block := range content.Blocks {
+			if idx.firstFile == "" {
+				idx.firstFile = block.DefRange.Filename
+			}
+			switch block.Type {
+			case "resource", "data":
+				idx.blocks[block.Type+"."+strings.Join(block.Labels, ".")] = block.DefRange
+			case "module":
+				idx.blocks["module."+block.Labels[0]] = block.DefRange
+				if moduleDir, ok := localModuleDir(dir, block); ok {
+					idx.localModules[block.Labels[0]] = moduleDir
+				}
+			}
+		}
+	}
+	return idx
+}
+
+// Locate the block declaring a resource of the project at projectPath. Resources in remote modules
+// resolve to the innermost local `module` block calling them; when nothing matches, the project's
+// first configuration file is returned. ok is false when the project has no readable configuration.
+func (l *ResourceLocator) Locate(projectPath string, res ResourceDrift) (location SourceLocation, ok bool) {
+	dir, err := filepath.Abs(projectPath)
+	if err != nil {
+		return SourceLocation{}, false
+	}
+	root := l.index(dir)
+	if root.firstFile == "" {
+		return SourceLocation{}, false
+	}
+	location = SourceLocation{File: root.firstFile, StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 1}
+
+	for _, name := range moduleNames(res.ModulePath) {
+		idx := l.index(dir)
+		r, found := idx.blocks["module."+name]
+		if !found {
+			return location, true
+		}
+		location = sourceLocation(r)
+		if dir, found = idx.localModules[name]; !found {
+			return location, true
+		}
+	}
+
+	mode := "resource"
+	localAddress := strings.TrimPrefix(strings.TrimPrefix(res.Address, res.ModulePath), ".")
+	if strings.HasPrefix(localAddress, "data.") {
+		mode = "data"
+	}
+	if r, found := l.index(dir).blocks[mode+"."+res.Type+"."+res.Name]; found {
+		location = sourceLocation(r)
+	}
+	return location, true
+}
+
+// Split a module address such as module.a["x"].module.b[0] into its call names (a, b).
+func moduleNames(modulePath string) []string {
+	var names []string
+	rest := modulePath
+	for strings.HasPrefix(rest, "module.") {
+		rest = rest[len("module."):]
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		names = append(names, rest[:end])
+		rest = rest[end:]
+		if strings.HasPrefix(rest, "[") {
+			rest = rest[instanceKeyLength(rest):]
+		}
+		rest = strings.TrimPrefix(rest, ".")
+	}
+	return names
+}
+
+// Length of the instance key at the start of s, e.g. [0] or ["a.b"], including the brackets.
+func instanceKeyLength(s string) int {
+	inString := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case inString && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inString = !inString
+		case !inString && s[i] == ']':
+			return i + 1
+		}
+	}
+	return len(s)
+}
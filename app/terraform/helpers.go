@@ -3,6 +3,7 @@ package terraform
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	tfjson "github.com/hashicorp/terraform-json"
 
@@ -13,13 +14,35 @@ import (
 // Default TerraformService struct for clairvoyance reporting.
 type TerraformService struct {
 	//State            *tfjson.State `json:"state"`
-	ProjectName      string `json:"project_name"`
-	TerraformVersion string `json:"terraform_version"`
-	CountAdd         int    `json:"count_add"`
-	CountChange      int    `json:"count_change"`
-	CountDestroy     int    `json:"count_destroy"`
-	Summary          string `json:"summary"`
-	PlanFile         string `json:"plan_file"`
+	ProjectName string `json:"project_name"`
+	ProjectPath string `json:"project_path"`
+	Status      Status `json:"status"`
+	// Phase that failed (install, init, show, plan) and its trimmed error, for failed statuses
+	FailedPhase      string    `json:"failed_phase,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	DurationSeconds  float64   `json:"duration_seconds"`
+	TerraformVersion string    `json:"terraform_version"`
+	// Where TerraformVersion came from, see SelectTerraformVersion
+	TerraformVersionSource string `json:"terraform_version_source"`
+	CountAdd               int    `json:"count_add"`
+	CountChange            int    `json:"count_change"`
+	CountDestroy           int    `json:"count_destroy"`
+	// Objects changed outside of Terraform. They are not part of the add, change and destroy counts:
+	// a refresh-only plan changes no infrastructure.
+	CountOutside int `json:"count_changed_outside"`
+	// Every resource with a planned change, the counts above are derived from these. In refresh-only
+	// mode, the objects changed outside of Terraform.
+	Resources []ResourceDrift `json:"resources"`
+	// Plan mode the project was scanned with, see ScanOptions.Mode
+	Mode string `json:"mode"`
+	// Objects changed outside of Terraform, from the plan's resource_drift
+	OutsideChanges []ResourceDrift `json:"changed_outside_terraform,omitempty"`
+	// Planned changes not explained by OutsideChanges (both mode)
+	PendingChanges []ResourceDrift `json:"pending_code_changes,omitempty"`
+	Summary        string          `json:"summary"`
+	PlanFile       string          `json:"plan_file"`
+	PlanOutput     string          `json:"plan_output,omitempty"`
 }
 
 // Retrieve full file path to the project's terraform.tfstate
@@ -33,14 +56,14 @@ func GetStateFile(tfProjectPath string) string {
 func GetProjectName(projectName string) (string, string) {
 	// Clean the path to handle trailing slashes and resolve . or ..
 	cleanPath := filepath.Clean(projectName)
-	
+
 	// Get absolute path to resolve relative paths like "."
 	absPath, err := filepath.Abs(cleanPath)
 	if err != nil {
 		// Fallback to clean path if absolute path fails
 		absPath = cleanPath
 	}
-	
+
 	dir := filepath.Dir(absPath)
 	file := filepath.Base(absPath)
 	return dir, file
@@ -0,0 +1,119 @@
+package terraform
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"tfdrift/log"
+)
+
+// Default destination of the HTML report.
+const DefaultHTMLFile = "index.html"
+
+// Page template, stylesheet and script of the HTML report. Assets are inlined into the page so the
+// report works offline and can be attached to a CI job as a single file.
+//
+//go:embed templates/report.html.tmpl templates/report.css templates/report.js
+var htmlTemplates embed.FS
+
+var htmlTemplate = template.Must(template.New("report.html.tmpl").
+	Funcs(template.FuncMap{"join": strings.Join}).
+	ParseFS(htmlTemplates, "templates/report.html.tmpl"))
+
+// Data passed to report.html.tmpl.
+type htmlReport struct {
+	Report   *ScanReport
+	Duration time.Duration
+	// Show the Pending Code Changes column (both mode) and the Changed Outside Terraform column
+	// (both or refresh-only mode).
+	Categories    bool
+	OutsideColumn bool
+	Columns       int
+	Drifted       []htmlProject
+	Failed        []htmlProject
+	Outside       []htmlProject
+	// Plans shown expanded and no script, for mail clients.
+	Static bool
+	CSS    template.CSS
+	JS     template.JS
+}
+
+type htmlProject struct {
+	*TerraformService
+	// Element id of the project's rows, derived from its position so it is always a valid id.
+	ID string
+	// Project path relative to the scanned root.
+	Path string
+	// Trimmed plan text.
+	Plan string
+}
+
+// Write the scan as a self-contained HTML page to path (DefaultHTMLFile when empty).
+func GenerateHTML(report *ScanReport, path string) error {
+	if path == "" {
+		path = DefaultHTMLFile
+	}
+	w, err := CreateOutput(path)
+	if err != nil {
+		return err
+	}
+	if err := RenderHTML(w, report, false); err != nil {
+		w.Close()
+		return err
+	}
+	log.Printf("[GenerateHTML] Wrote HTML report to %s", outputName(path))
+	return w.Close()
+}
+
+// Render the scan as a self-contained HTML page. A static page has every plan expanded and no script,
+// for mail clients. Every value is escaped by html/template, so plan text is shown verbatim.
+func RenderHTML(w io.Writer, report *ScanReport, static bool) error {
+	css, err := htmlTemplates.ReadFile("templates/report.css")
+	if err != nil {
+		return err
+	}
+	js, err := htmlTemplates.ReadFile("templates/report.js")
+	if err != nil {
+		return err
+	}
+
+	data := htmlReport{
+		Report:     report,
+		Duration:   time.Duration(report.DurationSeconds * float64(time.Second)).Round(time.Second),
+		Categories: hasMode(report.Projects, ModeBoth),
+		Columns:    6,
+		Static:     static,
+		CSS:        template.CSS(css),
+		JS:         template.JS(js),
+	}
+	data.OutsideColumn = data.Categories || hasMode(report.Projects, ModeRefreshOnly)
+	if data.OutsideColumn {
+		data.Columns++
+	}
+	if data.Categories {
+		data.Columns++
+	}
+	for i, service := range report.Projects {
+		project := htmlProject{
+			TerraformService: service,
+			ID:               fmt.Sprintf("project-%d", i),
+			Path:             DisplayPath(report.RootPath, service),
+		}
+		switch {
+		case service.Status == StatusDrift:
+			project.Plan = TerraformPlanTrim(service.PlanOutput)
+			data.Drifted = append(data.Drifted, project)
+		case service.Status.Failed():
+			data.Failed = append(data.Failed, project)
+		}
+		if len(service.OutsideChanges) > 0 {
+			data.Outside = append(data.Outside, project)
+		}
+	}
+
+	return htmlTemplate.Execute(w, data)
+}
@@ -0,0 +1,282 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hc-install/product"
+	"github.com/hashicorp/hc-install/releases"
+	tfexec "github.com/hashicorp/terraform-exec/tfexec"
+
+	"tfdrift/log"
+)
+
+// Number of download attempts before a Terraform release is reported as unavailable.
+const installAttempts = 3
+
+// Resolves the Terraform binary for each requested version once per scan.
+// Lookup order: ExecPath, the on-disk cache, a matching `terraform` on PATH, then a download
+// from releases.hashicorp.com into the cache.
+type BinaryManager struct {
+	// Directory where downloaded releases are kept between runs.
+	CacheDir string
+	// Binary used for every project regardless of the requested version (--terraform-path).
+	ExecPath string
+	// Bounds the downloads and the release listing shared by every project, so one project's timeout
+	// never fails the others waiting on them. The scan context, context.Background() when nil.
+	ScanContext context.Context
+
+	mu       sync.Mutex
+	binaries map[string]*binary
+
+	versionsOnce sync.Once
+	versionsDone chan struct{}
+	versions     version.Collection
+
+	execPathOnce    sync.Once
+	execPathDone    chan struct{}
+	execPathVersion string
+	execPathErr     error
+}
+
+// Result of resolving a single version, shared by every project asking for it.
+// done is closed once execPath and err are set.
+type binary struct {
+	done     chan struct{}
+	execPath string
+	err      error
+}
+
+// Create a BinaryManager caching releases in cacheDir (DefaultCacheDir when empty).
+func NewBinaryManager(cacheDir string, execPath string) *BinaryManager {
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir()
+	}
+	return &BinaryManager{
+		CacheDir: cacheDir,
+		ExecPath: execPath,
+		binaries: make(map[string]*binary),
+	}
+}
+
+// Default location for cached Terraform releases, e.g. ~/.cache/tfdrift/terraform
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "tfdrift", "terraform")
+}
+
+// Return the path to a Terraform binary for terraformVersion, installing it if needed.
+// Concurrent callers asking for the same version wait for a single resolution.
+func (m *BinaryManager) Resolve(ctx context.Context, terraformVersion string) (string, error) {
+	if m.ExecPath != "" {
+		// A bare name such as "terraform" is looked up on PATH
+		execPath, err := exec.LookPath(m.ExecPath)
+		if err != nil {
+			return "", fmt.Errorf("terraform binary %s: %w", m.ExecPath, err)
+		}
+		return execPath, nil
+	}
+
+	m.mu.Lock()
+	if m.binaries == nil {
+		m.binaries = make(map[string]*binary)
+	}
+	b, ok := m.binaries[terraformVersion]
+	if !ok {
+		b = &binary{done: make(chan struct{})}
+		m.binaries[terraformVersion] = b
+		go func() {
+			defer close(b.done)
+			b.execPath, b.err = m.resolve(m.scanContext(), terraformVersion)
+		}()
+	}
+	m.mu.Unlock()
+
+	// A caller giving up leaves the download running for the other projects
+	select {
+	case <-b.done:
+		return b.execPath, b.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (m *BinaryManager) scanContext() context.Context {
+	if m.ScanContext == nil {
+		return context.Background()
+	}
+	return m.ScanContext
+}
+
+func (m *BinaryManager) resolve(ctx context.Context, terraformVersion string) (string, error) {
+	v, err := version.NewVersion(terraformVersion)
+	if err != nil {
+		return "", fmt.Errorf("invalid terraform version %q: %w", terraformVersion, err)
+	}
+
+	// Cached from a previous run
+	cachedPath := filepath.Join(m.CacheDir, v.String(), product.Terraform.BinaryName())
+	if info, err := os.Stat(cachedPath); err == nil && !info.IsDir() {
+		log.Debugf("[BinaryManager] Using cached terraform %s: %s", v, cachedPath)
+		return cachedPath, nil
+	}
+
+	// Already installed on PATH
+	if pathBinary, err := exec.LookPath(product.Terraform.BinaryName()); err == nil {
+		if pathVersion, err := binaryVersion(ctx, pathBinary); err != nil {
+			log.Debugf("[BinaryManager] Unable to read version of %s: %s", pathBinary, err)
+		} else if pathVersion.Equal(v) {
+			log.Debugf("[BinaryManager] Using terraform %s from PATH: %s", v, pathBinary)
+			return pathBinary, nil
+		}
+	}
+
+	var installErr error
+	for attempt := 1; attempt <= installAttempts; attempt++ {
+		execPath, err := m.install(ctx, v)
+		if err == nil {
+			return execPath, nil
+		}
+		installErr = err
+		log.Warnf("[BinaryManager] Attempt %d/%d to install terraform %s failed: %s", attempt, installAttempts, v, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", fmt.Errorf("error installing terraform %s: %w", v, installErr)
+}
+
+// Download a release into a scratch directory and move it into the cache once complete,
+// so an interrupted download never leaves a broken binary behind.
+func (m *BinaryManager) install(ctx context.Context, v *version.Version) (string, error) {
+	if err := os.MkdirAll(m.CacheDir, 0o755); err != nil {
+		return "", err
+	}
+	tmpDir, err := os.MkdirTemp(m.CacheDir, fmt.Sprintf(".%s-*", v))
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	log.Infof("[BinaryManager] Downloading terraform %s", v)
+	installer := &releases.ExactVersion{
+		Product:    product.Terraform,
+		Version:    v,
+		InstallDir: tmpDir,
+	}
+	if _, err := installer.Install(ctx); err != nil {
+		return "", err
+	}
+
+	versionDir := filepath.Join(m.CacheDir, v.String())
+	if err := os.Rename(tmpDir, versionDir); err != nil {
+		// Another tfdrift process may have finished the same download first
+		if _, statErr := os.Stat(versionDir); statErr != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(versionDir, product.Terraform.BinaryName()), nil
+}
+
+// Ask a terraform binary for its version.
+func binaryVersion(ctx context.Context, execPath string) (*version.Version, error) {
+	tf, err := tfexec.NewTerraform(os.TempDir(), execPath)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := tf.Version(ctx, true)
+	return v, err
+}
+
+// Return every Terraform release that can be selected, oldest first. The releases.hashicorp.com
+// index is queried once per scan; when it is unreachable only cached and PATH binaries are offered.
+// Fails only when ctx is done before the listing finished.
+func (m *BinaryManager) AvailableVersions(ctx context.Context) (version.Collection, error) {
+	m.versionsOnce.Do(func() {
+		m.versionsDone = make(chan struct{})
+		go func() {
+			defer close(m.versionsDone)
+			scanCtx := m.scanContext()
+			lister := &releases.Versions{Product: product.Terraform}
+			sources, err := lister.List(scanCtx)
+			if err == nil {
+				for _, source := range sources {
+					if ev, ok := source.(*releases.ExactVersion); ok {
+						m.versions = append(m.versions, ev.Version)
+					}
+				}
+			} else {
+				log.Warnf("[BinaryManager] Unable to list terraform releases, using local binaries only: %s", err)
+				m.versions = m.localVersions(scanCtx)
+			}
+			sort.Sort(m.versions)
+		}()
+	})
+	select {
+	case <-m.versionsDone:
+		return m.versions, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Versions installed in the cache directory or on PATH.
+func (m *BinaryManager) localVersions(ctx context.Context) version.Collection {
+	var versions version.Collection
+	entries, _ := os.ReadDir(m.CacheDir)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		v, err := version.NewVersion(entry.Name())
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(m.CacheDir, entry.Name(), product.Terraform.BinaryName())); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	if pathBinary, err := exec.LookPath(product.Terraform.BinaryName()); err == nil {
+		if v, err := binaryVersion(ctx, pathBinary); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// Version of the binary given by ExecPath, asked once per scan.
+func (m *BinaryManager) ExecPathVersion(ctx context.Context) (string, error) {
+	m.execPathOnce.Do(func() {
+		m.execPathDone = make(chan struct{})
+		go func() {
+			defer close(m.execPathDone)
+			scanCtx := m.scanContext()
+			execPath, err := m.Resolve(scanCtx, "")
+			if err != nil {
+				m.execPathErr = err
+				return
+			}
+			v, err := binaryVersion(scanCtx, execPath)
+			if err != nil {
+				m.execPathErr = err
+				return
+			}
+			m.execPathVersion = v.String()
+		}()
+	})
+	select {
+	case <-m.execPathDone:
+		return m.execPathVersion, m.execPathErr
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+package terraform
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"tfdrift/log"
+)
+
+// JUnit XML as understood by GitLab, Jenkins and the GitHub test reporters.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// Write the report as JUnit XML to path, or stdout when path is empty or "-".
+// Each project is a testcase: drift is a failure, failed projects are errors, skipped projects are
+// skipped and clean projects pass.
+func WriteJUnitReport(report *ScanReport, path string) error {
+	suite := junitTestSuite{
+		Name:      "tfdrift",
+		Time:      junitSeconds(report.DurationSeconds),
+		Timestamp: report.StartedAt.Format("2006-01-02T15:04:05"),
+	}
+	for _, service := range report.Projects {
+		testCase := junitTestCase{
+			Name:      DisplayPath(report.RootPath, service),
+			ClassName: "tfdrift." + service.ProjectName,
+			Time:      junitSeconds(service.DurationSeconds),
+		}
+		switch {
+		case service.Status == StatusDrift:
+			testCase.Failure = &junitMessage{
+				Message: ResourceSummary(service),
+				Type:    string(service.Status),
+				Body:    resourceList(service.Resources),
+			}
+			testCase.SystemOut = TerraformPlanTrim(service.PlanOutput)
+			suite.Failures++
+		case service.Status == StatusSkipped:
+			testCase.Skipped = &junitMessage{Message: service.Summary, Type: string(service.Status)}
+			suite.Skipped++
+		case service.Status.Failed():
+			testCase.Error = &junitMessage{
+				Message: fmt.Sprintf("%s (%s)", service.Summary, service.FailedPhase),
+				Type:    string(service.Status),
+				Body:    service.Error,
+			}
+			suite.Errors++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+	}
+
+	suites := junitTestSuites{
+		Name:     "tfdrift",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	w, err := CreateOutput(path)
+	if err != nil {
+		return err
+	}
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		w.Close()
+		return err
+	}
+	w.Write([]byte("\n"))
+	log.Debugf("[WriteJUnitReport] Wrote JUnit report to %s", outputName(path))
+	return w.Close()
+}
+
+// One line summary of a project's planned changes, e.g. "Plan: 1 to add, 2 to change, 0 to destroy.",
+// followed by the number of objects changed outside of Terraform when there are any.
+func ResourceSummary(service *TerraformService) string {
+	summary := fmt.Sprintf("Plan: %d to add, %d to change, %d to destroy.", service.CountAdd, service.CountChange, service.CountDestroy)
+	if service.CountOutside > 0 {
+		summary += fmt.Sprintf(" %d changed outside Terraform.", service.CountOutside)
+	}
+	return summary
+}
+
+// One "action address" line per resource.
+func resourceList(resources []ResourceDrift) string {
+	var lines []string
+	for _, res := range resources {
+		lines = append(lines, fmt.Sprintf("%s %s", res.Action, res.Address))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func junitSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
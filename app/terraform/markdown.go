@@ -0,0 +1,248 @@
+package terraform
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"tfdrift/log"
+)
+
+// Default size cap of the Markdown report, a little under GitHub's 65536 character comment limit.
+// GitLab allows 1,000,000 characters per note.
+const DefaultMarkdownLimit = 65000
+
+// Smallest amount of plan text worth showing once the report is close to its size cap.
+const minMarkdownPlan = 500
+
+// Render the scan as Markdown for a pull/merge request comment: a summary table, a collapsible
+// block with the trimmed plan of every drifted project and a table of failed projects.
+// The result never exceeds limit bytes (no cap when limit <= 0). Plans are truncated first,
+// at line boundaries and outside of code fences, so the comment always renders.
+func RenderMarkdown(report *ScanReport, limit int) string {
+	var head strings.Builder
+	head.WriteString("## Terraform Drift Report\n\n")
+	fmt.Fprintf(&head, "**%d drifted**, %d failed, %d without drift out of %d projects. Mode `%s`, %s.\n\n",
+		report.Totals.Drifted, report.Totals.Failed, report.Totals.NoDrift, report.Totals.Projects,
+		report.Mode, time.Duration(report.DurationSeconds*float64(time.Second)).Round(time.Second))
+
+	if len(report.Projects) > 0 {
+		outside := hasMode(report.Projects, ModeBoth) || hasMode(report.Projects, ModeRefreshOnly)
+		if outside {
+			head.WriteString("| Project | Status | Add | Change | Destroy | Changed outside | Terraform |\n")
+			head.WriteString("|---|---|--:|--:|--:|--:|---|\n")
+		} else {
+			head.WriteString("| Project | Status | Add | Change | Destroy | Terraform |\n")
+			head.WriteString("|---|---|--:|--:|--:|---|\n")
+		}
+		for _, service := range report.Projects {
+			fmt.Fprintf(&head, "| %s | %s | %d | %d | %d |",
+				markdownCell(DisplayPath(report.RootPath, service)), markdownStatus(service.Status),
+				service.CountAdd, service.CountChange, service.CountDestroy)
+			if outside {
+				fmt.Fprintf(&head, " %d |", service.CountOutside)
+			}
+			fmt.Fprintf(&head, " %s |\n", markdownCell(service.TerraformVersion))
+		}
+		head.WriteString("\n")
+	}
+
+	var failed strings.Builder
+	if report.Totals.Failed > 0 {
+		failed.WriteString("### Failed projects\n\n")
+		failed.WriteString("| Project | Status | Phase | Error |\n")
+		failed.WriteString("|---|---|---|---|\n")
+		for _, service := range report.Projects {
+			if service.Status.Failed() {
+				fmt.Fprintf(&failed, "| %s | %s | %s | %s |\n",
+					markdownCell(DisplayPath(report.RootPath, service)), markdownCell(service.Summary),
+					markdownCell(service.FailedPhase), markdownCell(service.Error))
+			}
+		}
+		failed.WriteString("\n")
+	}
+
+	var drifted []*TerraformService
+	for _, service := range report.Projects {
+		if service.Status == StatusDrift {
+			drifted = append(drifted, service)
+		}
+	}
+
+	var details strings.Builder
+	if len(drifted) > 0 {
+		details.WriteString("### Drifted projects\n\n")
+	}
+	omitted := 0
+	for i, service := range drifted {
+		project := DisplayPath(report.RootPath, service)
+		plan := strings.TrimRight(TerraformPlanTrim(service.PlanOutput), "\n")
+		block := markdownDetails(project, service, plan)
+
+		if limit > 0 {
+			// Leave room for the note on the plans after this one, the last plan needs none. Writing
+			// the previous plan left room for a note including this one.
+			rest := len(drifted) - i - 1
+			budget := limit - head.Len() - failed.Len() - details.Len()
+			if rest > 0 {
+				budget -= len(markdownOmitted(rest))
+			}
+			if len(block) > budget {
+				// Keep as much of this plan as fits, then stop adding plans.
+				empty := markdownDetails(project, service, "")
+				if budget-len(empty) >= minMarkdownPlan {
+					details.WriteString(markdownDetails(project, service, truncateLines(plan, budget-len(empty))))
+					omitted = rest
+				} else {
+					omitted = rest + 1
+				}
+				break
+			}
+		}
+		details.WriteString(block)
+	}
+	if omitted > 0 {
+		details.WriteString(markdownOmitted(omitted))
+	}
+
+	markdown := head.String() + details.String() + failed.String()
+	if limit > 0 && len(markdown) > limit {
+		// Too many projects for even the tables: cut whole rows.
+		note := "\n_Report truncated to fit the size limit._\n"
+		end := limit - len(note)
+		if end < 0 {
+			end = 0
+		}
+		markdown = markdown[:strings.LastIndex(markdown[:end], "\n")+1] + note
+	}
+	log.Debugf("[RenderMarkdown] Rendered %d bytes, %d drifted projects without plan", len(markdown), omitted)
+	return markdown
+}
+
+// Write the Markdown report to path, or stdout when path is empty or "-".
+func WriteMarkdownReport(report *ScanReport, path string, limit int) error {
+	w, err := CreateOutput(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, RenderMarkdown(report, limit)); err != nil {
+		w.Close()
+		return err
+	}
+	log.Debugf("[WriteMarkdownReport] Wrote Markdown report to %s", outputName(path))
+	return w.Close()
+}
+
+// Resources listed in a project's Markdown, the rest are counted.
+const maxMarkdownResources = 100
+
+// Markdown for one drifted project, e.g. an issue body: its change counts, the changed resources and
+// the trimmed plan, which is cut at line boundaries so the result stays within limit bytes.
+func RenderProjectMarkdown(report *ScanReport, service *TerraformService, limit int) string {
+	project := DisplayPath(report.RootPath, service)
+	var head strings.Builder
+	fmt.Fprintf(&head, "`%s`: %s Mode `%s`, Terraform %s.\n\n", strings.ReplaceAll(project, "`", "'"),
+		ResourceSummary(service), service.Mode, service.TerraformVersion)
+
+	if len(service.Resources) > 0 {
+		head.WriteString("| Resource | Action | Changed attributes |\n")
+		head.WriteString("|---|---|---|\n")
+		for i, res := range service.Resources {
+			if i == maxMarkdownResources {
+				fmt.Fprintf(&head, "\n_…and %d more resources._\n", len(service.Resources)-i)
+				break
+			}
+			fmt.Fprintf(&head, "| %s | %s | %s |\n", markdownCell(res.Address), res.Action,
+				markdownCell(strings.Join(res.ChangedAttributes, ", ")))
+		}
+		head.WriteString("\n")
+	}
+
+	plan := strings.TrimRight(TerraformPlanTrim(service.PlanOutput), "\n")
+	if plan == "" {
+		return head.String()
+	}
+	block := markdownDetails(project, service, plan)
+	if budget := limit - head.Len(); limit > 0 && len(block) > budget {
+		empty := markdownDetails(project, service, "")
+		if budget-len(empty) < minMarkdownPlan {
+			return head.String() + "_Plan omitted to fit the size limit, see the full report._\n\n"
+		}
+		block = markdownDetails(project, service, truncateLines(plan, budget-len(empty)))
+	}
+	return head.String() + block
+}
+
+// Collapsible block with a drifted project's plan. An empty plan renders the block without a code fence.
+func markdownDetails(project string, service *TerraformService, plan string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<details>\n<summary><code>%s</code>: %s</summary>\n\n", htmlEscaper.Replace(project), ResourceSummary(service))
+	if plan != "" {
+		fence := markdownFence(plan)
+		fmt.Fprintf(&b, "%s\n%s\n%s\n\n", fence, plan, fence)
+	}
+	b.WriteString("</details>\n\n")
+	return b.String()
+}
+
+func markdownOmitted(count int) string {
+	return fmt.Sprintf("_Plans of %d drifted projects omitted to fit the size limit, see the full report._\n\n", count)
+}
+
+func markdownStatus(status Status) string {
+	switch {
+	case status == StatusDrift:
+		return ":warning: " + status.Description()
+	case status.Failed():
+		return ":x: " + status.Description()
+	}
+	return ":white_check_mark: " + status.Description()
+}
+
+// A code fence longer than any run of backticks in s, so the content cannot close it.
+func markdownFence(s string) string {
+	longest, run := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// Make s safe for a single table cell: one line, no column separators, no HTML.
+var markdownCellEscaper = strings.NewReplacer("|", `\|`, "\r", "", "\n", "<br>", "<", "&lt;", ">", "&gt;")
+
+func markdownCell(s string) string {
+	return markdownCellEscaper.Replace(strings.TrimSpace(s))
+}
+
+// Cut s to at most max bytes at a line boundary, noting how many lines were dropped.
+func truncateLines(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	kept := 0
+	size := 0
+	for _, line := range lines {
+		note := fmt.Sprintf("… %d more lines", len(lines)-kept)
+		if size+len(line)+1+len(note) > max {
+			break
+		}
+		size += len(line) + 1
+		kept++
+	}
+	return strings.Join(lines[:kept], "\n") + fmt.Sprintf("\n… %d more lines", len(lines)-kept)
+}
@@ -0,0 +1,164 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Human readable plan changing n resources, about 200 bytes each.
+func testPlanOutput(n int) string {
+	var b strings.Builder
+	b.WriteString("Refreshing state...\n\nTerraform will perform the following actions:\n\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "  # aws_instance.web[%d] will be updated in-place\n", i)
+		fmt.Fprintf(&b, "  ~ resource \"aws_instance\" \"web\" {\n")
+		fmt.Fprintf(&b, "      ~ tags = {\n          ~ \"env\" = \"dev\" -> \"prod\"\n        }\n")
+		fmt.Fprintf(&b, "        id   = \"i-%08d\"\n    }\n\n", i)
+	}
+	fmt.Fprintf(&b, "Plan: 0 to add, %d to change, 0 to destroy.\n", n)
+	return b.String()
+}
+
+// Scan of drifted projects each changing resources resources, plus failed and clean ones.
+func testMarkdownReport(drifted int, failed int, clean int, resources int) *ScanReport {
+	var services []*TerraformService
+	for i := 0; i < drifted; i++ {
+		service := NewProjectService(fmt.Sprintf("/infra/drifted-%03d", i))
+		service.SetStatus(StatusDrift)
+		service.CountChange = resources
+		service.TerraformVersion = "1.5.7"
+		service.PlanOutput = testPlanOutput(resources)
+		services = append(services, service)
+	}
+	for i := 0; i < failed; i++ {
+		service := NewProjectService(fmt.Sprintf("/infra/failed-%03d", i))
+		service.SetFailure(StatusPlanFailed, PhasePlan, fmt.Errorf("Error: Invalid value for \"region\"\n\n  on main.tf line %d", i))
+		services = append(services, service)
+	}
+	for i := 0; i < clean; i++ {
+		service := NewProjectService(fmt.Sprintf("/infra/clean-%03d", i))
+		service.SetStatus(StatusNoDrift)
+		services = append(services, service)
+	}
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return NewScanReport("/infra", "test", ModeFull, started, started.Add(time.Minute), services)
+}
+
+// Check that every code fence is closed and <details> blocks open and close outside of fences.
+func checkMarkdownStructure(t *testing.T, markdown string) {
+	t.Helper()
+	fence := ""
+	depth := 0
+	for n, line := range strings.Split(markdown, "\n") {
+		switch {
+		case fence != "":
+			if line == fence {
+				fence = ""
+			}
+		case strings.HasPrefix(line, "```"):
+			fence = line
+		case line == "<details>":
+			depth++
+		case line == "</details>":
+			depth--
+			if depth < 0 {
+				t.Fatalf("line %d closes a <details> that was never opened", n+1)
+			}
+		}
+	}
+	if fence != "" {
+		t.Errorf("code fence %s is not closed", fence)
+	}
+	if depth != 0 {
+		t.Errorf("%d <details> blocks are not closed", depth)
+	}
+}
+
+func TestRenderMarkdownLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		report *ScanReport
+		limit  int
+		// Expected in the output
+		contains []string
+	}{
+		{
+			name:     "everything fits",
+			report:   testMarkdownReport(2, 1, 3, 5),
+			limit:    DefaultMarkdownLimit,
+			contains: []string{"drifted-000", "drifted-001", "aws_instance.web[4]", "### Failed projects", "clean-002"},
+		},
+		{
+			name:     "later plans are omitted",
+			report:   testMarkdownReport(40, 5, 10, 30),
+			limit:    DefaultMarkdownLimit,
+			contains: []string{"<code>drifted-000</code>", "drifted projects omitted to fit the size limit", "failed-004", "clean-009"},
+		},
+		{
+			name:     "a single plan larger than the limit is cut",
+			report:   testMarkdownReport(1, 0, 0, 2000),
+			limit:    DefaultMarkdownLimit,
+			contains: []string{"aws_instance.web[0]", "more lines"},
+		},
+		{
+			name:     "tables larger than the limit are cut",
+			report:   testMarkdownReport(300, 300, 2000, 5),
+			limit:    DefaultMarkdownLimit,
+			contains: []string{"Report truncated to fit the size limit"},
+		},
+		{
+			name:     "small limit",
+			report:   testMarkdownReport(3, 1, 0, 50),
+			limit:    4000,
+			contains: []string{"drifted-000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unlimited := RenderMarkdown(tt.report, 0)
+			if tt.name != "everything fits" && len(unlimited) <= tt.limit {
+				t.Fatalf("report of %d bytes does not exceed the limit of %d", len(unlimited), tt.limit)
+			}
+			markdown := RenderMarkdown(tt.report, tt.limit)
+			if len(markdown) > tt.limit {
+				t.Errorf("RenderMarkdown() = %d bytes, over the limit of %d", len(markdown), tt.limit)
+			}
+			checkMarkdownStructure(t, markdown)
+			for _, want := range tt.contains {
+				if !strings.Contains(markdown, want) {
+					t.Errorf("RenderMarkdown() does not contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownAnyLimit(t *testing.T) {
+	report := testMarkdownReport(12, 4, 20, 80)
+	full := RenderMarkdown(report, 0)
+	checkMarkdownStructure(t, full)
+	for limit := 1000; limit <= len(full)+1000; limit += 997 {
+		markdown := RenderMarkdown(report, limit)
+		if len(markdown) > limit {
+			t.Fatalf("RenderMarkdown(limit %d) = %d bytes", limit, len(markdown))
+		}
+		checkMarkdownStructure(t, markdown)
+	}
+	if got := RenderMarkdown(report, len(full)); got != full {
+		t.Error("a report within the limit is changed")
+	}
+}
+
+func TestRenderMarkdownFenceInPlan(t *testing.T) {
+	report := testMarkdownReport(1, 0, 0, 1)
+	report.Projects[0].PlanOutput = "Terraform will perform the following actions:\n\n" +
+		"      ~ user_data = <<-EOT\n          ```\n          ````sh\n          echo hi\n        EOT\n"
+	markdown := RenderMarkdown(report, DefaultMarkdownLimit)
+	if !strings.Contains(markdown, "`````\n") {
+		t.Errorf("plan containing ```` is not fenced with five backticks:\n%s", markdown)
+	}
+	checkMarkdownStructure(t, markdown)
+}
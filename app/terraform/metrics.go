@@ -0,0 +1,146 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tfdrift/log"
+)
+
+// Content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Every status, so tfdrift_project_status always has one series per status for each project.
+var metricStatuses = []Status{
+	StatusNoDrift, StatusDrift, StatusInitFailed, StatusPlanFailed, StatusShowFailed,
+	StatusSkipped, StatusTimedOut, StatusCancelled, StatusInternalError,
+}
+
+// Every counted action, so tfdrift_resources_changed reports zeros instead of missing series.
+var metricActions = []string{ActionCreate, ActionUpdate, ActionDelete, ActionReplace, ActionRead}
+
+// Write the report in the Prometheus text exposition format. Projects are labelled with their path
+// relative to the scanned root.
+func WriteMetrics(w io.Writer, report *ScanReport) error {
+	var b bytes.Buffer
+	metric := func(name string, kind string, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("tfdrift_project_drift", "gauge", "Whether the project's plan has changes (1) or not (0).")
+	for _, service := range report.Projects {
+		drift := 0
+		if service.Status == StatusDrift {
+			drift = 1
+		}
+		fmt.Fprintf(&b, "tfdrift_project_drift{project=%s} %d\n", metricLabel(DisplayPath(report.RootPath, service)), drift)
+	}
+
+	metric("tfdrift_resources_changed", "gauge", "Resources with a planned change, by action.")
+	for _, service := range report.Projects {
+		counts := make(map[string]int)
+		for _, res := range service.Resources {
+			counts[res.Action]++
+		}
+		project := metricLabel(DisplayPath(report.RootPath, service))
+		for _, action := range metricActions {
+			fmt.Fprintf(&b, "tfdrift_resources_changed{project=%s,action=%s} %d\n", project, metricLabel(action), counts[action])
+		}
+	}
+
+	metric("tfdrift_project_scan_duration_seconds", "gauge", "Time spent scanning the project.")
+	for _, service := range report.Projects {
+		fmt.Fprintf(&b, "tfdrift_project_scan_duration_seconds{project=%s} %.3f\n", metricLabel(DisplayPath(report.RootPath, service)), service.DurationSeconds)
+	}
+
+	metric("tfdrift_project_status", "gauge", "Outcome of the project scan, 1 for the current status.")
+	for _, service := range report.Projects {
+		project := metricLabel(DisplayPath(report.RootPath, service))
+		for _, status := range metricStatuses {
+			value := 0
+			if service.Status == status {
+				value = 1
+			}
+			fmt.Fprintf(&b, "tfdrift_project_status{project=%s,status=%s} %d\n", project, metricLabel(string(status)), value)
+		}
+	}
+
+	metric("tfdrift_scan_duration_seconds", "gauge", "Time spent scanning all projects.")
+	fmt.Fprintf(&b, "tfdrift_scan_duration_seconds %.3f\n", report.DurationSeconds)
+
+	metric("tfdrift_last_scan_timestamp", "gauge", "Unix time the last scan finished.")
+	fmt.Fprintf(&b, "tfdrift_last_scan_timestamp %d\n", report.FinishedAt.Unix())
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Write the metrics for node_exporter's textfile collector. The file is written next to path and
+// renamed into place, so the collector never reads a partial file.
+func WriteMetricsFile(report *ScanReport, path string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteMetrics(tmp, report); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	log.Printf("[WriteMetricsFile] Wrote metrics to %s", path)
+	return nil
+}
+
+// Push the metrics to a Pushgateway, replacing the previous push of the same job.
+func PushMetrics(ctx context.Context, report *ScanReport, gatewayURL string, job string) error {
+	var body bytes.Buffer
+	if err := WriteMetrics(&body, report); err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", metricsContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	log.Printf("[PushMetrics] Pushed metrics to %s", endpoint)
+	return nil
+}
+
+// Quote a label value, escaping backslashes, double quotes and line feeds.
+func metricLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
@@ -0,0 +1,202 @@
+package terraform
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Normalized change actions for a ResourceDrift.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionReplace = "replace"
+	ActionRead    = "read"
+	ActionNoOp    = "no-op"
+)
+
+// A single resource instance that Terraform plans to change.
+type ResourceDrift struct {
+	Address    string `json:"address"`
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Provider   string `json:"provider"`
+	ModulePath string `json:"module_path,omitempty"`
+	Action     string `json:"action"`
+	// Attribute paths whose value differs between before and after, e.g. tags.env or ingress[0].cidr_blocks
+	ChangedAttributes []string `json:"changed_attributes,omitempty"`
+}
+
+// Reduce a plan's action list to a single action, e.g. ["delete", "create"] is a replace.
+func ActionFromPlan(actions tfjson.Actions) string {
+	switch {
+	case actions.Replace():
+		return ActionReplace
+	case actions.Create():
+		return ActionCreate
+	case actions.Update():
+		return ActionUpdate
+	case actions.Delete():
+		return ActionDelete
+	case actions.Read():
+		return ActionRead
+	default:
+		return ActionNoOp
+	}
+}
+
+// Return every resource in the plan that has something other than a no-op planned.
+func ResourceChanges(plan *tfjson.Plan) []ResourceDrift {
+	if plan == nil {
+		return nil
+	}
+	return resourceDrifts(plan.ResourceChanges)
+}
+
+// Return the objects Terraform found changed outside of Terraform while refreshing (`resource_drift`).
+func OutsideChanges(plan *tfjson.Plan) []ResourceDrift {
+	if plan == nil {
+		return nil
+	}
+	return resourceDrifts(plan.ResourceDrift)
+}
+
+// Convert plan resource changes to ResourceDrift, skipping no-ops.
+func resourceDrifts(changes []*tfjson.ResourceChange) []ResourceDrift {
+	var resources []ResourceDrift
+	for _, rc := range changes {
+		if rc == nil || rc.Change == nil {
+			continue
+		}
+		action := ActionFromPlan(rc.Change.Actions)
+		if action == ActionNoOp {
+			continue
+		}
+		res := ResourceDrift{
+			Address:    rc.Address,
+			Type:       rc.Type,
+			Name:       rc.Name,
+			Provider:   rc.ProviderName,
+			ModulePath: rc.ModuleAddress,
+			Action:     action,
+		}
+		if action == ActionUpdate || action == ActionReplace {
+			res.ChangedAttributes = ChangedAttributes(rc.Change)
+		}
+		resources = append(resources, res)
+	}
+	return resources
+}
+
+// Planned changes that are not explained by out-of-band drift, i.e. code that was merged but
+// never applied. A resource that drifted and also has new code is reported only as drift.
+func PendingChanges(planned []ResourceDrift, outside []ResourceDrift) []ResourceDrift {
+	drifted := make(map[string]bool)
+	for _, res := range outside {
+		drifted[res.Address] = true
+	}
+
+	var pending []ResourceDrift
+	for _, res := range planned {
+		if !drifted[res.Address] {
+			pending = append(pending, res)
+		}
+	}
+	return pending
+}
+
+// Count resources the same way Terraform's "Plan: X to add, Y to change, Z to destroy." line does.
+// A replace counts as one add and one destroy; reads are not counted.
+func CountResourceChanges(resources []ResourceDrift) (int, int, int) {
+	var add, change, destroy int
+	for _, res := range resources {
+		switch res.Action {
+		case ActionCreate:
+			add++
+		case ActionUpdate:
+			change++
+		case ActionDelete:
+			destroy++
+		case ActionReplace:
+			add++
+			destroy++
+		}
+	}
+	return add, change, destroy
+}
+
+// Return the sorted attribute paths that differ between a change's before and after values.
+// Values only known after apply are reported as changed.
+func ChangedAttributes(change *tfjson.Change) []string {
+	if change == nil {
+		return nil
+	}
+	paths := make(map[string]bool)
+	diffValues("", change.Before, change.After, paths)
+	unknownPaths("", change.AfterUnknown, paths)
+
+	var attributes []string
+	for path := range paths {
+		attributes = append(attributes, path)
+	}
+	sort.Strings(attributes)
+	return attributes
+}
+
+// Walk before and after together, recording the deepest paths that differ.
+func diffValues(path string, before interface{}, after interface{}, paths map[string]bool) {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		for key := range beforeMap {
+			diffValues(joinAttributePath(path, key), beforeMap[key], afterMap[key], paths)
+		}
+		for key := range afterMap {
+			if _, ok := beforeMap[key]; !ok {
+				diffValues(joinAttributePath(path, key), nil, afterMap[key], paths)
+			}
+		}
+		return
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList && len(beforeList) == len(afterList) {
+		for i := range beforeList {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), beforeList[i], afterList[i], paths)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) && path != "" {
+		paths[path] = true
+	}
+}
+
+// Record every path marked true in an after_unknown structure.
+func unknownPaths(path string, unknown interface{}, paths map[string]bool) {
+	switch value := unknown.(type) {
+	case bool:
+		if value && path != "" {
+			paths[path] = true
+		}
+	case map[string]interface{}:
+		for key, nested := range value {
+			unknownPaths(joinAttributePath(path, key), nested, paths)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			unknownPaths(fmt.Sprintf("%s[%d]", path, i), nested, paths)
+		}
+	}
+}
+
+func joinAttributePath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,236 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Plan decoded from the JSON of `terraform show -json`, given its top-level fields besides format_version.
+func testPlan(t *testing.T, fields string) *tfjson.Plan {
+	t.Helper()
+	var plan tfjson.Plan
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"format_version": "1.2", %s}`, fields)), &plan); err != nil {
+		t.Fatal(err)
+	}
+	return &plan
+}
+
+// Address, module path and action of each resource, e.g. "module.app.aws_instance.web (module.app) update".
+func resourceSummaries(resources []ResourceDrift) []string {
+	var summaries []string
+	for _, res := range resources {
+		summary := res.Address
+		if res.ModulePath != "" {
+			summary += " (" + res.ModulePath + ")"
+		}
+		summaries = append(summaries, summary+" "+res.Action)
+	}
+	return summaries
+}
+
+func TestResourceChanges(t *testing.T) {
+	tests := []struct {
+		name                string
+		resourceChanges     string
+		want                []string
+		add, change, delete int
+	}{
+		{
+			name: "create, update and delete",
+			resourceChanges: `[
+				{"address": "aws_s3_bucket.logs", "type": "aws_s3_bucket", "name": "logs", "change": {"actions": ["create"]}},
+				{"address": "aws_instance.web", "type": "aws_instance", "name": "web", "change": {"actions": ["update"]}},
+				{"address": "aws_eip.old", "type": "aws_eip", "name": "old", "change": {"actions": ["delete"]}}
+			]`,
+			want: []string{"aws_s3_bucket.logs create", "aws_instance.web update", "aws_eip.old delete"},
+			add:  1, change: 1, delete: 1,
+		},
+		{
+			name: "replace counts as one add and one destroy",
+			resourceChanges: `[
+				{"address": "aws_instance.web", "change": {"actions": ["delete", "create"]}},
+				{"address": "aws_instance.api", "change": {"actions": ["create", "delete"]}}
+			]`,
+			want: []string{"aws_instance.web replace", "aws_instance.api replace"},
+			add:  2, change: 0, delete: 2,
+		},
+		{
+			name: "reads are listed but not counted, no-ops are left out",
+			resourceChanges: `[
+				{"address": "data.aws_ami.ubuntu", "mode": "data", "change": {"actions": ["read"]}},
+				{"address": "aws_vpc.main", "change": {"actions": ["no-op"]}},
+				{"address": "aws_subnet.a", "change": {"actions": ["update"]}}
+			]`,
+			want: []string{"data.aws_ami.ubuntu read", "aws_subnet.a update"},
+			add:  0, change: 1, delete: 0,
+		},
+		{
+			// "Plan: 1 to import, 0 to add, 1 to change, 0 to destroy."
+			name: "imports are not counted as adds",
+			resourceChanges: `[
+				{"address": "aws_iam_role.ci", "change": {"actions": ["no-op"], "importing": {"id": "ci"}}},
+				{"address": "aws_iam_role.deploy", "change": {"actions": ["update"], "importing": {"id": "deploy"}}}
+			]`,
+			want: []string{"aws_iam_role.deploy update"},
+			add:  0, change: 1, delete: 0,
+		},
+		{
+			name: "module addresses",
+			resourceChanges: `[
+				{
+					"address": "module.network.module.subnets[\"a\"].aws_subnet.this[0]",
+					"module_address": "module.network.module.subnets[\"a\"]",
+					"type": "aws_subnet", "name": "this", "index": 0,
+					"provider_name": "registry.terraform.io/hashicorp/aws",
+					"change": {"actions": ["create"]}
+				},
+				{"address": "module.dns.aws_route53_record.www", "module_address": "module.dns", "change": {"actions": ["delete"]}}
+			]`,
+			want: []string{
+				`module.network.module.subnets["a"].aws_subnet.this[0] (module.network.module.subnets["a"]) create`,
+				"module.dns.aws_route53_record.www (module.dns) delete",
+			},
+			add: 1, change: 0, delete: 1,
+		},
+		{
+			name:            "no changes",
+			resourceChanges: `[{"address": "aws_vpc.main", "change": {"actions": ["no-op"]}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := ResourceChanges(testPlan(t, `"resource_changes": `+tt.resourceChanges))
+			if got := resourceSummaries(resources); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResourceChanges() = %q, want %q", got, tt.want)
+			}
+			add, change, destroy := CountResourceChanges(resources)
+			if add != tt.add || change != tt.change || destroy != tt.delete {
+				t.Errorf("CountResourceChanges() = %d to add, %d to change, %d to destroy, want %d, %d, %d",
+					add, change, destroy, tt.add, tt.change, tt.delete)
+			}
+		})
+	}
+}
+
+func TestResourceChangesFields(t *testing.T) {
+	resources := ResourceChanges(testPlan(t, `"resource_changes": [{
+		"address": "module.app.aws_instance.web",
+		"module_address": "module.app",
+		"type": "aws_instance",
+		"name": "web",
+		"provider_name": "registry.terraform.io/hashicorp/aws",
+		"change": {"actions": ["create"]}
+	}]`))
+	want := ResourceDrift{
+		Address:    "module.app.aws_instance.web",
+		Type:       "aws_instance",
+		Name:       "web",
+		Provider:   "registry.terraform.io/hashicorp/aws",
+		ModulePath: "module.app",
+		Action:     ActionCreate,
+	}
+	if len(resources) != 1 || !reflect.DeepEqual(resources[0], want) {
+		t.Errorf("ResourceChanges() = %+v, want [%+v]", resources, want)
+	}
+	if resources := ResourceChanges(nil); len(resources) != 0 {
+		t.Errorf("ResourceChanges(nil) = %+v", resources)
+	}
+}
+
+func TestChangedAttributes(t *testing.T) {
+	tests := []struct {
+		name   string
+		change string
+		want   []string
+	}{
+		{
+			name: "nested maps and lists",
+			change: `{
+				"actions": ["update"],
+				"before": {"name": "web", "tags": {"env": "dev", "team": "a"}, "ingress": [{"port": 22, "cidr_blocks": ["10.0.0.0/8", "10.1.0.0/16"]}]},
+				"after":  {"name": "web", "tags": {"env": "prod", "team": "a"}, "ingress": [{"port": 22, "cidr_blocks": ["10.0.0.0/8", "0.0.0.0/0"]}]}
+			}`,
+			want: []string{"ingress[0].cidr_blocks[1]", "tags.env"},
+		},
+		{
+			name: "added and removed keys",
+			change: `{
+				"actions": ["update"],
+				"before": {"tags": {"old": "x"}, "description": "web"},
+				"after":  {"tags": {"new": "y"}}
+			}`,
+			want: []string{"description", "tags.new", "tags.old"},
+		},
+		{
+			name: "a list changing length is changed as a whole",
+			change: `{
+				"actions": ["update"],
+				"before": {"security_groups": ["sg-1"]},
+				"after":  {"security_groups": ["sg-1", "sg-2"]}
+			}`,
+			want: []string{"security_groups"},
+		},
+		{
+			name: "values known after apply",
+			change: `{
+				"actions": ["update"],
+				"before": {"arn": "arn:1", "rules": [{"id": "r1", "port": 80}]},
+				"after":  {"rules": [{"port": 80}]},
+				"after_unknown": {"arn": true, "rules": [{"id": true, "port": false}]}
+			}`,
+			want: []string{"arn", "rules[0].id"},
+		},
+		{
+			name:   "unchanged",
+			change: `{"actions": ["update"], "before": {"tags": {"env": "dev"}}, "after": {"tags": {"env": "dev"}}}`,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var change tfjson.Change
+			if err := json.Unmarshal([]byte(tt.change), &change); err != nil {
+				t.Fatal(err)
+			}
+			if got := ChangedAttributes(&change); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedAttributes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutsideChanges(t *testing.T) {
+	plan := testPlan(t, `
+		"resource_drift": [
+			{"address": "aws_security_group.web", "change": {"actions": ["update"], "before": {"tags": {"env": "dev"}}, "after": {"tags": {"env": "prod"}}}},
+			{"address": "aws_instance.gone", "change": {"actions": ["delete"], "before": {"id": "i-1"}, "after": null}}
+		],
+		"resource_changes": [
+			{"address": "aws_security_group.web", "change": {"actions": ["update"], "before": {"tags": {"env": "prod"}}, "after": {"tags": {"env": "dev"}}}},
+			{"address": "aws_s3_bucket.new", "change": {"actions": ["create"]}}
+		]`)
+
+	outside := OutsideChanges(plan)
+	if got, want := resourceSummaries(outside), []string{"aws_security_group.web update", "aws_instance.gone delete"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("OutsideChanges() = %q, want %q", got, want)
+	}
+	if got, want := outside[0].ChangedAttributes, []string{"tags.env"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedAttributes = %q, want %q", got, want)
+	}
+	// Deletes have no attributes to compare
+	if outside[1].ChangedAttributes != nil {
+		t.Errorf("ChangedAttributes of a delete = %q", outside[1].ChangedAttributes)
+	}
+
+	// A resource that drifted is not pending code, even when Terraform plans to change it back
+	pending := PendingChanges(ResourceChanges(plan), outside)
+	if got, want := resourceSummaries(pending), []string{"aws_s3_bucket.new create"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PendingChanges() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package terraform
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tfdrift/log"
+)
+
+// Version of the ScanReport JSON layout. Bump when fields are removed or change meaning.
+const ReportSchemaVersion = 1
+
+// Everything a scan found, plus metadata about the run. This is the document written by
+// `--output json` and the input of every other report format.
+type ScanReport struct {
+	SchemaVersion     int                 `json:"schema_version"`
+	ToolVersion       string              `json:"tfdrift_version"`
+	RootPath          string              `json:"root_path"`
+	Mode              string              `json:"mode"`
+	StartedAt         time.Time           `json:"started_at"`
+	FinishedAt        time.Time           `json:"finished_at"`
+	DurationSeconds   float64             `json:"duration_seconds"`
+	TerraformVersions []string            `json:"terraform_versions"`
+	Totals            ScanTotals          `json:"totals"`
+	Projects          []*TerraformService `json:"projects"`
+}
+
+// Project counts per outcome.
+type ScanTotals struct {
+	Projects int `json:"projects"`
+	NoDrift  int `json:"no_drift"`
+	Drifted  int `json:"drifted"`
+	Failed   int `json:"failed"`
+}
+
+// Build the report for a finished scan.
+func NewScanReport(rootPath string, toolVersion string, mode string, startedAt time.Time, finishedAt time.Time, tsArray []*TerraformService) *ScanReport {
+	if absPath, err := filepath.Abs(rootPath); err == nil {
+		rootPath = absPath
+	}
+	report := &ScanReport{
+		SchemaVersion:   ReportSchemaVersion,
+		ToolVersion:     toolVersion,
+		RootPath:        rootPath,
+		Mode:            mode,
+		StartedAt:       startedAt.UTC(),
+		FinishedAt:      finishedAt.UTC(),
+		DurationSeconds: finishedAt.Sub(startedAt).Seconds(),
+		Projects:        tsArray,
+	}
+	if report.Projects == nil {
+		report.Projects = []*TerraformService{}
+	}
+
+	report.summarize()
+	return report
+}
+
+// Copy of the report with only the projects keep returns true for, totals recomputed.
+func (r *ScanReport) Filter(keep func(*TerraformService) bool) *ScanReport {
+	filtered := *r
+	filtered.Projects = []*TerraformService{}
+	for _, service := range r.Projects {
+		if keep(service) {
+			filtered.Projects = append(filtered.Projects, service)
+		}
+	}
+	filtered.summarize()
+	return &filtered
+}
+
+// Fill Totals and TerraformVersions from Projects.
+func (r *ScanReport) summarize() {
+	r.Totals = ScanTotals{}
+	r.TerraformVersions = []string{}
+	versions := make(map[string]bool)
+	for _, service := range r.Projects {
+		if service.TerraformVersion != "" && !versions[service.TerraformVersion] {
+			versions[service.TerraformVersion] = true
+			r.TerraformVersions = append(r.TerraformVersions, service.TerraformVersion)
+		}
+
+		r.Totals.Projects++
+		switch {
+		case service.Status == StatusDrift:
+			r.Totals.Drifted++
+		case service.Status.Failed():
+			r.Totals.Failed++
+		default:
+			r.Totals.NoDrift++
+		}
+	}
+	sort.Strings(r.TerraformVersions)
+}
+
+// Project path relative to the scanned root, so nested projects with the same name stay distinct.
+// Falls back to the project name when the project is the root itself or lies outside it.
+func DisplayPath(rootPath string, service *TerraformService) string {
+	projectPath, err := filepath.Abs(service.ProjectPath)
+	if err != nil || service.ProjectPath == "" {
+		return service.ProjectName
+	}
+	rel, err := filepath.Rel(rootPath, projectPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return service.ProjectName
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Write the report as indented JSON to path, or stdout when path is empty or "-".
+func WriteJSONReport(report *ScanReport, path string) error {
+	w, err := CreateOutput(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		w.Close()
+		return err
+	}
+	log.Debugf("[WriteJSONReport] Wrote JSON report to %s", outputName(path))
+	return w.Close()
+}
+
+// Open a report destination: stdout when path is empty or "-", otherwise a new file.
+func CreateOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return os.Create(path)
+}
+
+func outputName(path string) string {
+	if path == "" || path == "-" {
+		return "stdout"
+	}
+	return path
+}
+
+// Keeps stdout open when a report writer is closed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
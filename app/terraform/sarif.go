@@ -0,0 +1,256 @@
+package terraform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tfdrift/log"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolInfoURI  = "https://github.com/pyang55/tfdrift"
+)
+
+// SARIF 2.1.0, limited to the parts code-scanning dashboards read.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	StartTimeUTC               string              `json:"startTimeUtc"`
+	EndTimeUTC                 string              `json:"endTimeUtc"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations,omitempty"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints"`
+	Properties          map[string]interface{} `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// One rule per change action. Destroying changes are errors, in-place changes warnings.
+var sarifRules = []struct {
+	action      string
+	name        string
+	level       string
+	description string
+}{
+	{ActionDelete, "DriftDelete", "error", "Terraform would destroy a resource"},
+	{ActionReplace, "DriftReplace", "error", "Terraform would destroy and recreate a resource"},
+	{ActionUpdate, "DriftUpdate", "warning", "Terraform would update a resource in place"},
+	{ActionCreate, "DriftCreate", "warning", "Terraform would create a resource"},
+	{ActionRead, "DriftRead", "note", "Terraform would read a data source during apply"},
+}
+
+func sarifRuleID(action string) string {
+	return "tfdrift/" + action
+}
+
+// Write the report as SARIF 2.1.0 to path, or stdout when path is empty or "-".
+// Every changed resource of a drifted project is a result pointing at the block that declares it.
+// Failed projects are reported as tool execution notifications, since they produced no results.
+func WriteSARIFReport(report *ScanReport, path string) error {
+	driver := sarifDriver{Name: "tfdrift", Version: report.ToolVersion, InformationURI: toolInfoURI}
+	levels := make(map[string]string)
+	for _, rule := range sarifRules {
+		levels[rule.action] = rule.level
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   sarifRuleID(rule.action),
+			Name:                 rule.name,
+			ShortDescription:     sarifMessage{Text: rule.description},
+			DefaultConfiguration: sarifConfiguration{Level: rule.level},
+		})
+	}
+
+	invocation := sarifInvocation{
+		ExecutionSuccessful: report.Totals.Failed == 0,
+		StartTimeUTC:        report.StartedAt.Format("2006-01-02T15:04:05.000Z"),
+		EndTimeUTC:          report.FinishedAt.Format("2006-01-02T15:04:05.000Z"),
+	}
+	results := []sarifResult{}
+	locator := NewResourceLocator()
+	for _, service := range report.Projects {
+		project := DisplayPath(report.RootPath, service)
+		if service.Status.Failed() {
+			message := fmt.Sprintf("%s: %s", project, service.Summary)
+			if service.Error != "" {
+				message = fmt.Sprintf("%s (%s) %s", message, service.FailedPhase, service.Error)
+			}
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+				Level:   "error",
+				Message: sarifMessage{Text: message},
+			})
+			continue
+		}
+		if service.Status != StatusDrift {
+			continue
+		}
+
+		for _, res := range service.Resources {
+			level, ok := levels[res.Action]
+			if !ok {
+				continue
+			}
+			result := sarifResult{
+				RuleID:  sarifRuleID(res.Action),
+				Level:   level,
+				Message: sarifMessage{Text: sarifResultMessage(project, res)},
+				PartialFingerprints: map[string]string{
+					"tfdriftResource/v1": fingerprint(project, res.Address, res.Action),
+				},
+				Properties: map[string]interface{}{
+					"project":  project,
+					"address":  res.Address,
+					"action":   res.Action,
+					"provider": res.Provider,
+				},
+			}
+			if location, ok := locator.Locate(service.ProjectPath, res); ok {
+				result.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: sarifURI(location.File)},
+					Region: &sarifRegion{
+						StartLine:   location.StartLine,
+						StartColumn: location.StartCol,
+						EndLine:     location.EndLine,
+						EndColumn:   location.EndCol,
+					},
+				}}}
+			}
+			results = append(results, result)
+		}
+	}
+
+	sarif := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool:        sarifTool{Driver: driver},
+			Invocations: []sarifInvocation{invocation},
+			Results:     results,
+		}},
+	}
+
+	w, err := CreateOutput(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(sarif); err != nil {
+		w.Close()
+		return err
+	}
+	log.Debugf("[WriteSARIFReport] Wrote %d SARIF results to %s", len(results), outputName(path))
+	return w.Close()
+}
+
+// e.g. "network: aws_s3_bucket.b will be updated in place (tags.env)"
+func sarifResultMessage(project string, res ResourceDrift) string {
+	var verb string
+	switch res.Action {
+	case ActionDelete:
+		verb = "will be destroyed"
+	case ActionReplace:
+		verb = "must be replaced"
+	case ActionUpdate:
+		verb = "will be updated in place"
+	case ActionCreate:
+		verb = "will be created"
+	case ActionRead:
+		verb = "will be read during apply"
+	default:
+		verb = res.Action
+	}
+	message := fmt.Sprintf("%s: %s %s", project, res.Address, verb)
+	if len(res.ChangedAttributes) > 0 {
+		message += fmt.Sprintf(" (%s)", strings.Join(res.ChangedAttributes, ", "))
+	}
+	return message
+}
+
+// Stable identifier of a finding across runs, so dashboards track one alert per resource and action.
+func fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Artifact URI for a file: relative to the working directory (the repository root in CI) when the file
+// is inside it, an absolute file URI otherwise.
+func sarifURI(file string) string {
+	wd, _ := os.Getwd()
+	path := workspacePath(wd, file)
+	if filepath.IsAbs(filepath.FromSlash(path)) {
+		return "file://" + path
+	}
+	return path
+}
@@ -0,0 +1,147 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"tfdrift/log"
+)
+
+// Which kinds of plan are run for each project.
+const (
+	// Regular plan: out-of-band changes and unapplied code changes together.
+	ModeFull = "full"
+	// `terraform plan -refresh-only`: only changes made outside of Terraform.
+	ModeRefreshOnly = "refresh-only"
+	// Both plans, reported as separate categories.
+	ModeBoth = "both"
+)
+
+// Options shared by every project in a single scan.
+type ScanOptions struct {
+	BackendConfig string
+	// Fallback Terraform version, or the version used for every project when DetectVersion is false.
+	TerraformVersion string
+	// Pick each project's version from .terraform-version, .tool-versions or required_version.
+	DetectVersion bool
+	// One of ModeFull, ModeRefreshOnly or ModeBoth.
+	Mode string
+	// Shared Terraform installs, resolved once per version for the whole scan.
+	Binaries *BinaryManager
+	// Run init and plan in a scratch copy of the projects instead of the user's checkout.
+	Isolate bool
+	// Parent directory of the scratch copy, the system temp directory when empty.
+	ScratchDir string
+	// Maximum time spent on a single project, no limit when 0.
+	ProjectTimeout time.Duration
+	// Number of projects processed at the same time.
+	Concurrency int
+	// Number of `terraform init` runs allowed at the same time. Concurrent inits sharing
+	// a plugin cache can block each other: https://github.com/hashicorp/terraform/issues/32915
+	InitConcurrency int
+
+	// Limits how many `terraform init` commands run at once across the workers of one scan,
+	// created by ScanProjects from InitConcurrency. No limit when nil.
+	initSlots chan struct{}
+}
+
+// Check that mode is one of ModeFull, ModeRefreshOnly or ModeBoth.
+func ValidMode(mode string) bool {
+	switch mode {
+	case ModeFull, ModeRefreshOnly, ModeBoth:
+		return true
+	}
+	return false
+}
+
+// Run DriftReport for every project using a fixed-size worker pool.
+// Results are returned in the same order as projects. Once ctx is done, projects that have not
+// started yet are reported as skipped without running.
+func ScanProjects(ctx context.Context, projects []string, opts ScanOptions) ([]*TerraformService, error) {
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(projects) {
+		workers = len(projects)
+	}
+	if opts.Mode == "" {
+		opts.Mode = ModeFull
+	}
+	if opts.Binaries == nil {
+		opts.Binaries = NewBinaryManager("", "")
+	}
+	if opts.Binaries.ScanContext == nil {
+		opts.Binaries.ScanContext = ctx
+	}
+	inits := opts.InitConcurrency
+	if inits < 1 {
+		inits = 1
+	}
+	opts.initSlots = make(chan struct{}, inits)
+	log.Debugf("[ScanProjects] Scanning %d projects with %d workers (%d concurrent inits)", len(projects), workers, inits)
+
+	var workspace *Workspace
+	if opts.Isolate {
+		var err error
+		workspace, err = NewWorkspace(projects, opts.ScratchDir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create scratch copy: %w", err)
+		}
+		defer workspace.Remove()
+	}
+
+	results := make([]*TerraformService, len(projects))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					results[i] = InterruptedService(ctx, projects[i], "")
+					continue
+				}
+				log.Printf("[ScanProjects] Getting values for project: %s", projects[i])
+				startedAt := time.Now()
+				results[i] = scanProject(ctx, projects[i], workspace, opts)
+				results[i].StartedAt = startedAt.UTC()
+				results[i].DurationSeconds = time.Since(startedAt).Seconds()
+			}
+		}()
+	}
+
+	for i := range projects {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// Scan one project, in the workspace copy when there is one. A panic is recorded as the project's
+// failure: left alone it would end the process with Go's exit code 2, which means drift.
+func scanProject(ctx context.Context, project string, workspace *Workspace, opts ScanOptions) (result *TerraformService) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("[scanProject] %s: %v\n%s", project, r, debug.Stack())
+			result = NewProjectService(project)
+			result.SetFailure(StatusInternalError, "", fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	if workspace == nil {
+		return DriftReport(ctx, project, opts)
+	}
+	result = DriftReportIn(ctx, project, workspace.Path(project), opts)
+	// Report the user's path, the scratch copy and its plan files are removed after the scan
+	result.ProjectPath = project
+	result.PlanFile = ""
+	return result
+}
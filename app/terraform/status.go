@@ -0,0 +1,102 @@
+package terraform
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Outcome of scanning a single project.
+type Status string
+
+const (
+	StatusNoDrift    Status = "no_drift"
+	StatusDrift      Status = "drift"
+	StatusInitFailed Status = "init_failed"
+	StatusPlanFailed Status = "plan_failed"
+	StatusShowFailed Status = "show_failed"
+	// Never started because the scan was stopped first.
+	StatusSkipped   Status = "skipped"
+	StatusTimedOut  Status = "timed_out"
+	StatusCancelled Status = "cancelled"
+	// tfdrift itself failed (a panic) while scanning the project.
+	StatusInternalError Status = "internal_error"
+)
+
+// Phase of a project scan that failed.
+const (
+	PhaseInstall = "install"
+	PhaseInit    = "init"
+	PhaseShow    = "show"
+	PhasePlan    = "plan"
+)
+
+// Maximum length of TerraformService.Error.
+const maxErrorLength = 2000
+
+// Human readable description of a status, used as TerraformService.Summary.
+func (s Status) Description() string {
+	switch s {
+	case StatusNoDrift:
+		return "No changes."
+	case StatusDrift:
+		return "Drift detected for Plan."
+	case StatusInitFailed:
+		return "Failed to initialize project."
+	case StatusPlanFailed:
+		return "Failed to plan project."
+	case StatusShowFailed:
+		return "Failed to read plan or state."
+	case StatusSkipped:
+		return "Skipped."
+	case StatusTimedOut:
+		return "Timed out."
+	case StatusCancelled:
+		return "Cancelled."
+	case StatusInternalError:
+		return "tfdrift failed while scanning the project."
+	}
+	return string(s)
+}
+
+// Check whether the project did not produce a usable plan.
+func (s Status) Failed() bool {
+	return s != StatusNoDrift && s != StatusDrift
+}
+
+// Status for a project stopped by ctx: timed out on a deadline, cancelled otherwise.
+func interruptedStatus(ctx context.Context) Status {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return StatusTimedOut
+	}
+	return StatusCancelled
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// Reduce a terraform error to its message: colour codes, box drawing, blank lines and the
+// "exit status N" prefix added by os/exec are removed, and the result is capped at maxErrorLength.
+func TrimError(err error) string {
+	if err == nil {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(err.Error(), ""), "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "│╷╵ "))
+		if line == "" || strings.HasPrefix(line, "exit status ") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	message := strings.Join(lines, "\n")
+	if len(message) > maxErrorLength {
+		cut := maxErrorLength
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		message = message[:cut] + "…"
+	}
+	return message
+}
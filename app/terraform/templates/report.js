@@ -0,0 +1,68 @@
+// Expand a drifted project's plan when its row is clicked.
+function toggleRow(row) {
+  var details = document.getElementById(row.getAttribute('data-details'));
+  if (details) {
+    details.classList.toggle('open');
+  }
+}
+
+function toggleAllRows() {
+  var rows = document.querySelectorAll('.details-row');
+  var anyOpen = Array.prototype.some.call(rows, function (row) {
+    return row.classList.contains('open');
+  });
+  rows.forEach(function (row) {
+    row.classList.toggle('open', !anyOpen);
+  });
+}
+
+// Sort a table by the clicked column. A project's details row stays attached to it.
+function sortTable(th) {
+  var table = th.closest('table');
+  var tbody = table.tBodies[0];
+  var column = Array.prototype.indexOf.call(th.parentNode.children, th);
+  var ascending = !th.classList.contains('sorted-asc');
+
+  var groups = [];
+  Array.prototype.forEach.call(tbody.rows, function (row) {
+    if (row.classList.contains('details-row')) {
+      groups[groups.length - 1].push(row);
+    } else {
+      groups.push([row]);
+    }
+  });
+
+  groups.sort(function (a, b) {
+    var x = a[0].cells[column].textContent.trim();
+    var y = b[0].cells[column].textContent.trim();
+    var cmp = (x !== '' && y !== '' && !isNaN(x) && !isNaN(y)) ? Number(x) - Number(y) : x.localeCompare(y);
+    return ascending ? cmp : -cmp;
+  });
+  groups.forEach(function (group) {
+    group.forEach(function (row) {
+      tbody.appendChild(row);
+    });
+  });
+
+  th.parentNode.querySelectorAll('th').forEach(function (header) {
+    header.classList.remove('sorted-asc', 'sorted-desc');
+  });
+  th.classList.add(ascending ? 'sorted-asc' : 'sorted-desc');
+}
+
+document.addEventListener('DOMContentLoaded', function () {
+  document.querySelectorAll('.clickable-row').forEach(function (row) {
+    row.addEventListener('click', function () {
+      toggleRow(row);
+    });
+  });
+  document.querySelectorAll('table.sortable th').forEach(function (th) {
+    th.addEventListener('click', function () {
+      sortTable(th);
+    });
+  });
+  var toggle = document.getElementById('toggle-all');
+  if (toggle) {
+    toggle.addEventListener('click', toggleAllRows);
+  }
+});
@@ -4,50 +4,48 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/hashicorp/go-version"
-	"github.com/hashicorp/hc-install/product"
-	"github.com/hashicorp/hc-install/releases"
 	tfexec "github.com/hashicorp/terraform-exec/tfexec"
 	tfjson "github.com/hashicorp/terraform-json"
-
-	"tfdrift/log"
 )
 
-var TerraformContext = context.Background()
-
-func ConfigureTerraform(workingDir string, terraformVersion string) *tfexec.Terraform {
-	installer := &releases.ExactVersion{
-		Product: product.Terraform,
-		Version: version.Must(version.NewVersion(terraformVersion)),
-	}
-
-	execPath, err := installer.Install(context.Background())
+// Create a tfexec.Terraform for workingDir using the binary resolved for terraformVersion.
+func ConfigureTerraform(ctx context.Context, workingDir string, binaries *BinaryManager, terraformVersion string) (*tfexec.Terraform, error) {
+	execPath, err := binaries.Resolve(ctx, terraformVersion)
 	if err != nil {
-		log.Fatalf("error installing Terraform: %s", err)
+		return nil, err
 	}
 
 	tf, err := tfexec.NewTerraform(workingDir, execPath)
 	if err != nil {
-		log.Fatalf("error running NewTerraform: %s", err)
+		return nil, fmt.Errorf("error running NewTerraform: %w", err)
 	}
-	return tf
+	return tf, nil
 }
 
 // Run `terraform init` so that the working directories context can be initialized.
-func Init(tf *tfexec.Terraform, backendConfig ...string) (string, bool, error) {
+// Providers are upgraded, except in an isolated copy where the project's .terraform.lock.hcl is kept.
+func Init(ctx context.Context, tf *tfexec.Terraform, opts ScanOptions) (string, bool, error) {
 	var project string = tf.WorkingDir()
 	var failed bool = false
 
 	var initOptions []tfexec.InitOption
-	initOptions = append(initOptions, tfexec.Upgrade(true))
+	initOptions = append(initOptions, tfexec.Upgrade(!opts.Isolate))
 
-	if len(backendConfig) > 0 && backendConfig[0] != "" {
-		initOptions = append(initOptions, tfexec.BackendConfig(backendConfig[0]))
+	if opts.BackendConfig != "" {
+		initOptions = append(initOptions, tfexec.BackendConfig(opts.BackendConfig))
 	}
 
-	err := tf.Init(TerraformContext, initOptions...)
+	// Wait for a free init slot, see ScanOptions.InitConcurrency
+	if opts.initSlots != nil {
+		select {
+		case opts.initSlots <- struct{}{}:
+		case <-ctx.Done():
+			return project, true, ctx.Err()
+		}
+		defer func() { <-opts.initSlots }()
+	}
+	err := tf.Init(ctx, initOptions...)
 	if err != nil {
-		fmt.Println(err)
 		failed = true
 	}
 	return project, failed, err
@@ -58,10 +56,12 @@ func Init(tf *tfexec.Terraform, backendConfig ...string) (string, bool, error) {
 // 0 = false (no changes)
 // 1 = Error
 // 2 = true  (drift)
-func Plan(tf *tfexec.Terraform, outputName string) (int, error) {
+func Plan(ctx context.Context, tf *tfexec.Terraform, outputName string, opts ...tfexec.PlanOption) (int, error) {
 	var exitCode int
 
-	isPlanned, err := tf.Plan(TerraformContext, tfexec.Out(fmt.Sprintf("%s.tfplan", outputName)))
+	// A drift scan never writes state, so don't take a state lock that an interrupted plan could leave behind
+	opts = append(opts, tfexec.Lock(false), tfexec.Out(fmt.Sprintf("%s.tfplan", outputName)))
+	isPlanned, err := tf.Plan(ctx, opts...)
 	if err != nil {
 		exitCode = 1
 		return exitCode, err
@@ -77,17 +77,26 @@ func Plan(tf *tfexec.Terraform, outputName string) (int, error) {
 
 // View State after it's been initialized and refreshed
 // Run `terraform show` against the state defined in the working directory.
-func Show(tf *tfexec.Terraform) *tfjson.State {
-	state, err := tf.Show(TerraformContext)
+func Show(ctx context.Context, tf *tfexec.Terraform) (*tfjson.State, error) {
+	state, err := tf.Show(ctx)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return state
+	return state, err
 }
 
-// Run `terraform plan` against the state defined in the working directory.
-func ShowPlanFileRaw(tf *tfexec.Terraform, planPath string) (string, error) {
-	plan, err := tf.ShowPlanFileRaw(TerraformContext, planPath)
+// Run `terraform show -json` against a saved plan file.
+func ShowPlanFile(ctx context.Context, tf *tfexec.Terraform, planPath string) (*tfjson.Plan, error) {
+	plan, err := tf.ShowPlanFile(ctx, planPath)
+	if err != nil {
+		return nil, err
+	}
+	return plan, err
+}
+
+// Run `terraform show` against a saved plan file for the human readable output.
+func ShowPlanFileRaw(ctx context.Context, tf *tfexec.Terraform, planPath string) (string, error) {
+	plan, err := tf.ShowPlanFileRaw(ctx, planPath)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,181 @@
+package terraform
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+
+	"tfdrift/log"
+)
+
+// Where the Terraform version used for a project came from.
+const (
+	VersionSourceDefault          = "default"
+	VersionSourceFlag             = "--terraform-version"
+	VersionSourceTerraformPath    = "--terraform-path"
+	VersionSourceTerraformVersion = ".terraform-version"
+	VersionSourceToolVersions     = ".tool-versions"
+	VersionSourceRequiredVersion  = "required_version"
+)
+
+// Pick the Terraform version for a project and report where it came from.
+// Precedence: --terraform-path, an explicit --terraform-version, .terraform-version, .tool-versions,
+// then the newest release satisfying every `required_version` constraint. Anything that cannot be
+// resolved falls back to opts.TerraformVersion.
+func SelectTerraformVersion(ctx context.Context, projectPath string, opts ScanOptions) (string, string) {
+	if opts.Binaries != nil && opts.Binaries.ExecPath != "" {
+		v, err := opts.Binaries.ExecPathVersion(ctx)
+		if err != nil {
+			log.Warnf("[SelectTerraformVersion] Unable to read version of %s: %s", opts.Binaries.ExecPath, err)
+			return opts.TerraformVersion, VersionSourceTerraformPath
+		}
+		return v, VersionSourceTerraformPath
+	}
+	if !opts.DetectVersion {
+		return opts.TerraformVersion, VersionSourceFlag
+	}
+
+	constraints, err := RequiredVersions(projectPath)
+	if err != nil {
+		log.Debugf("[SelectTerraformVersion] Unable to read required_version for %s: %s", projectPath, err)
+	}
+
+	if pinned, file := findVersionFile(projectPath); pinned != "" {
+		v, err := resolveVersionFile(ctx, pinned, constraints, opts.Binaries)
+		if err == nil {
+			log.Debugf("[SelectTerraformVersion] %s pins terraform %s (%s)", projectPath, v, file)
+			return v, filepath.Base(file)
+		}
+		log.Warnf("[SelectTerraformVersion] Ignoring %s: %s", file, err)
+	}
+
+	if len(constraints) > 0 {
+		v, err := newestMatching(ctx, strings.Join(constraints, ","), opts.Binaries)
+		if err == nil {
+			log.Debugf("[SelectTerraformVersion] %s requires terraform %s, using %s", projectPath, strings.Join(constraints, ", "), v)
+			return v, VersionSourceRequiredVersion
+		}
+		log.Warnf("[SelectTerraformVersion] %s: %s", projectPath, err)
+	}
+
+	return opts.TerraformVersion, VersionSourceDefault
+}
+
+// Look for .terraform-version (tfenv) or .tool-versions (asdf) in projectPath and its parents.
+// Returns the version string and the file it was read from.
+func findVersionFile(projectPath string) (string, string) {
+	dir, err := filepath.Abs(projectPath)
+	if err != nil {
+		return "", ""
+	}
+	for {
+		file := filepath.Join(dir, VersionSourceTerraformVersion)
+		if b, err := os.ReadFile(file); err == nil {
+			if v := strings.TrimSpace(string(b)); v != "" {
+				return v, file
+			}
+		}
+
+		file = filepath.Join(dir, VersionSourceToolVersions)
+		if v := readToolVersions(file); v != "" {
+			return v, file
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// Return the terraform entry of an asdf .tool-versions file, e.g. "terraform 1.5.7".
+func readToolVersions(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "terraform" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// Turn a .terraform-version value into an exact version. Supports exact versions and the tfenv
+// keywords latest, latest-allowed and min-required.
+func resolveVersionFile(ctx context.Context, pinned string, constraints []string, binaries *BinaryManager) (string, error) {
+	switch pinned {
+	case "latest":
+		return newestMatching(ctx, ">= 0.0.0", binaries)
+	case "latest-allowed", "min-required":
+		if len(constraints) == 0 {
+			return "", fmt.Errorf("%s needs a required_version constraint", pinned)
+		}
+		if pinned == "latest-allowed" {
+			return newestMatching(ctx, strings.Join(constraints, ","), binaries)
+		}
+		return oldestMatching(ctx, strings.Join(constraints, ","), binaries)
+	}
+
+	v, err := version.NewVersion(pinned)
+	if err != nil {
+		return "", fmt.Errorf("invalid terraform version %q", pinned)
+	}
+	return v.String(), nil
+}
+
+// Newest available release satisfying constraint.
+func newestMatching(ctx context.Context, constraint string, binaries *BinaryManager) (string, error) {
+	matches, err := matchingVersions(ctx, constraint, binaries)
+	if err != nil {
+		return "", err
+	}
+	return matches[len(matches)-1].String(), nil
+}
+
+// Oldest available release satisfying constraint.
+func oldestMatching(ctx context.Context, constraint string, binaries *BinaryManager) (string, error) {
+	matches, err := matchingVersions(ctx, constraint, binaries)
+	if err != nil {
+		return "", err
+	}
+	return matches[0].String(), nil
+}
+
+// Available releases satisfying constraint, oldest first. Prereleases are only considered when
+// the constraint names one.
+func matchingVersions(ctx context.Context, constraint string, binaries *BinaryManager) (version.Collection, error) {
+	constraints, err := version.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+	if binaries == nil {
+		return nil, fmt.Errorf("no terraform releases available")
+	}
+
+	available, err := binaries.AvailableVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches version.Collection
+	for _, v := range available {
+		if constraints.Check(v) {
+			matches = append(matches, v)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no available terraform release satisfies %q", constraint)
+	}
+	return matches, nil
+}
@@ -0,0 +1,316 @@
+package terraform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+// BinaryManager offering exactly these releases, without listing releases.hashicorp.com.
+func testBinaries(t *testing.T, versions ...string) *BinaryManager {
+	t.Helper()
+	m := NewBinaryManager(t.TempDir(), "")
+	m.versionsOnce.Do(func() {
+		m.versionsDone = make(chan struct{})
+		close(m.versionsDone)
+		for _, v := range versions {
+			m.versions = append(m.versions, version.Must(version.NewVersion(v)))
+		}
+		sort.Sort(m.versions)
+	})
+	return m
+}
+
+// Create files (path relative to root, content) under root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var testReleases = []string{"1.3.9", "1.4.6", "1.5.0", "1.5.7", "1.6.0-beta1", "1.6.0", "1.7.0-rc1"}
+
+func TestSelectTerraformVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		detect      bool
+		wantVersion string
+		wantSource  string
+	}{
+		{
+			name:        "detection disabled uses the flag",
+			files:       map[string]string{"repo/stack/.terraform-version": "1.5.0"},
+			wantVersion: "1.4.6",
+			wantSource:  VersionSourceFlag,
+		},
+		{
+			name:        "nothing pinned falls back to the default",
+			files:       map[string]string{"repo/stack/main.tf": ""},
+			detect:      true,
+			wantVersion: "1.4.6",
+			wantSource:  VersionSourceDefault,
+		},
+		{
+			name:        ".terraform-version in the project",
+			files:       map[string]string{"repo/stack/.terraform-version": "1.5.0\n"},
+			detect:      true,
+			wantVersion: "1.5.0",
+			wantSource:  VersionSourceTerraformVersion,
+		},
+		{
+			name:        ".terraform-version in a parent directory",
+			files:       map[string]string{"repo/.terraform-version": "1.5.7", "repo/stack/main.tf": ""},
+			detect:      true,
+			wantVersion: "1.5.7",
+			wantSource:  VersionSourceTerraformVersion,
+		},
+		{
+			name: "the nearest version file wins",
+			files: map[string]string{
+				"repo/.terraform-version":   "1.5.7",
+				"repo/stack/.tool-versions": "nodejs 20.1.0\nterraform 1.3.9\n",
+			},
+			detect:      true,
+			wantVersion: "1.3.9",
+			wantSource:  VersionSourceToolVersions,
+		},
+		{
+			name: ".terraform-version wins over .tool-versions in the same directory",
+			files: map[string]string{
+				"repo/stack/.terraform-version": "1.5.0",
+				"repo/stack/.tool-versions":     "terraform 1.3.9",
+			},
+			detect:      true,
+			wantVersion: "1.5.0",
+			wantSource:  VersionSourceTerraformVersion,
+		},
+		{
+			name: ".tool-versions without terraform is ignored",
+			files: map[string]string{
+				"repo/stack/.tool-versions": "golang 1.21.0",
+				"repo/stack/main.tf":        `terraform { required_version = "~> 1.4.0" }`,
+			},
+			detect:      true,
+			wantVersion: "1.4.6",
+			wantSource:  VersionSourceRequiredVersion,
+		},
+		{
+			name:        "version file wins over required_version",
+			files:       map[string]string{"repo/stack/.terraform-version": "1.3.9", "repo/stack/main.tf": `terraform { required_version = ">= 1.5.0" }`},
+			detect:      true,
+			wantVersion: "1.3.9",
+			wantSource:  VersionSourceTerraformVersion,
+		},
+		{
+			name:        "required_version picks the newest final release",
+			files:       map[string]string{"repo/stack/main.tf": `terraform { required_version = ">= 1.5.0" }`},
+			detect:      true,
+			wantVersion: "1.6.0",
+			wantSource:  VersionSourceRequiredVersion,
+		},
+		{
+			name: "every required_version constraint applies",
+			files: map[string]string{
+				"repo/stack/main.tf":     `terraform { required_version = ">= 1.4.0" }`,
+				"repo/stack/versions.tf": `terraform { required_version = "< 1.5.7" }`,
+			},
+			detect:      true,
+			wantVersion: "1.5.0",
+			wantSource:  VersionSourceRequiredVersion,
+		},
+		{
+			name:        "unsatisfiable required_version falls back to the default",
+			files:       map[string]string{"repo/stack/main.tf": `terraform { required_version = ">= 2.0.0" }`},
+			detect:      true,
+			wantVersion: "1.4.6",
+			wantSource:  VersionSourceDefault,
+		},
+		{
+			name:        "invalid version file is ignored",
+			files:       map[string]string{"repo/stack/.terraform-version": "one.five", "repo/stack/main.tf": `terraform { required_version = "~> 1.3.0" }`},
+			detect:      true,
+			wantVersion: "1.3.9",
+			wantSource:  VersionSourceRequiredVersion,
+		},
+		{
+			name:        "latest",
+			files:       map[string]string{"repo/stack/.terraform-version": "latest"},
+			detect:      true,
+			wantVersion: "1.6.0",
+			wantSource:  VersionSourceTerraformVersion,
+		},
+		{
+			name:        "latest-allowed",
+			files:       map[string]string{"repo/stack/.terraform-version": "latest-allowed", "repo/stack/main.tf": `terraform { required_version = "< 1.5.0" }`},
+			detect:      true,
+			wantVersion: "1.4.6",
+			wantSource:  VersionSourceTerraformVersion,
+		},
+		{
+			name:        "min-required",
+			files:       map[string]string{"repo/stack/.terraform-version": "min-required", "repo/stack/main.tf": `terraform { required_version = ">= 1.4.0" }`},
+			detect:      true,
+			wantVersion: "1.4.6",
+			wantSource:  VersionSourceTerraformVersion,
+		},
+		{
+			name:        "min-required without required_version falls back to the default",
+			files:       map[string]string{"repo/stack/.terraform-version": "min-required", "repo/stack/main.tf": ""},
+			detect:      true,
+			wantVersion: "1.4.6",
+			wantSource:  VersionSourceDefault,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+			opts := ScanOptions{
+				TerraformVersion: "1.4.6",
+				DetectVersion:    tt.detect,
+				Binaries:         testBinaries(t, testReleases...),
+			}
+			gotVersion, gotSource := SelectTerraformVersion(context.Background(), filepath.Join(root, "repo", "stack"), opts)
+			if gotVersion != tt.wantVersion || gotSource != tt.wantSource {
+				t.Errorf("SelectTerraformVersion() = %s (%s), want %s (%s)", gotVersion, gotSource, tt.wantVersion, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestResolveVersionFile(t *testing.T) {
+	tests := []struct {
+		pinned      string
+		constraints []string
+		want        string
+		wantErr     bool
+	}{
+		{pinned: "1.5.7", want: "1.5.7"},
+		{pinned: "v1.5.7", want: "1.5.7"},
+		// Exact pins are used as written, prereleases included
+		{pinned: "1.7.0-rc1", want: "1.7.0-rc1"},
+		{pinned: "latest", want: "1.6.0"},
+		{pinned: "latest", constraints: []string{"< 1.5.0"}, want: "1.6.0"},
+		{pinned: "latest-allowed", constraints: []string{"~> 1.5.0"}, want: "1.5.7"},
+		{pinned: "latest-allowed", constraints: []string{">= 1.4.0", "< 1.6.0"}, want: "1.5.7"},
+		{pinned: "min-required", constraints: []string{">= 1.4.0"}, want: "1.4.6"},
+		{pinned: "min-required", constraints: []string{"> 1.4.6", "!= 1.5.0"}, want: "1.5.7"},
+		{pinned: "latest-allowed", wantErr: true},
+		{pinned: "min-required", wantErr: true},
+		{pinned: "min-required", constraints: []string{">= 3.0.0"}, wantErr: true},
+		{pinned: "newest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pinned, func(t *testing.T) {
+			got, err := resolveVersionFile(context.Background(), tt.pinned, tt.constraints, testBinaries(t, testReleases...))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolveVersionFile(%q, %v) = %s, want an error", tt.pinned, tt.constraints, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveVersionFile(%q, %v) = %s, %v, want %s", tt.pinned, tt.constraints, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchingVersionsPrereleases(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       []string
+	}{
+		{constraint: ">= 1.5.0", want: []string{"1.5.0", "1.5.7", "1.6.0"}},
+		{constraint: "~> 1.6", want: []string{"1.6.0"}},
+		// A constraint naming a prerelease selects prereleases of that version only
+		{constraint: ">= 1.6.0-beta1", want: []string{"1.6.0-beta1", "1.6.0"}},
+		{constraint: "1.7.0-rc1", want: []string{"1.7.0-rc1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			matches, err := matchingVersions(context.Background(), tt.constraint, testBinaries(t, testReleases...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range matches {
+				got = append(got, v.Original())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("matchingVersions(%q) = %v, want %v", tt.constraint, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("matchingVersions(%q) = %v, want %v", tt.constraint, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchingVersionsErrors(t *testing.T) {
+	if _, err := matchingVersions(context.Background(), "not a constraint", testBinaries(t, testReleases...)); err == nil {
+		t.Error("matchingVersions accepted an invalid constraint")
+	}
+	if _, err := matchingVersions(context.Background(), ">= 1.0", nil); err == nil {
+		t.Error("matchingVersions without a BinaryManager returned releases")
+	}
+	if _, err := matchingVersions(context.Background(), ">= 9.0", testBinaries(t, testReleases...)); err == nil {
+		t.Error("matchingVersions found a release for an unsatisfiable constraint")
+	}
+
+	// A caller giving up does not wait for the release listing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m := NewBinaryManager(t.TempDir(), "")
+	m.versionsOnce.Do(func() { m.versionsDone = make(chan struct{}) })
+	if _, err := matchingVersions(ctx, ">= 1.0", m); err != context.Canceled {
+		t.Errorf("matchingVersions with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestResolveExecPath(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"terraform-1.5": "#!/bin/sh\n"})
+	binary := filepath.Join(dir, "terraform-1.5")
+	if err := os.Chmod(binary, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	tests := []struct {
+		execPath string
+		want     string
+		wantErr  bool
+	}{
+		{execPath: binary, want: binary},
+		// --terraform-path terraform-1.5
+		{execPath: "terraform-1.5", want: binary},
+		{execPath: "terraform-missing", wantErr: true},
+		{execPath: filepath.Join(dir, "missing"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.execPath, func(t *testing.T) {
+			got, err := NewBinaryManager(t.TempDir(), tt.execPath).Resolve(context.Background(), "1.5.7")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Resolve() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
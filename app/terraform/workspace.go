@@ -0,0 +1,166 @@
+package terraform
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tfdrift/log"
+)
+
+// Directories never copied into a workspace: Terraform caches and VCS metadata.
+var workspaceSkipDirs = map[string]bool{
+	".terraform": true,
+	".git":       true,
+}
+
+// A per-run scratch copy of the scanned projects, so init and plan never modify the user's checkout.
+// The lowest directory containing every project and every local module they call is copied,
+// keeping relative module sources working.
+type Workspace struct {
+	// Original directory that was copied.
+	SourceRoot string
+	// Scratch directory holding the copy.
+	Dir string
+}
+
+// Copy the projects and their local modules into a new scratch directory under parent
+// (the system temp directory when empty).
+func NewWorkspace(projects []string, parent string) (*Workspace, error) {
+	var paths []string
+	for _, project := range projects {
+		absProject, err := filepath.Abs(project)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, absProject)
+		paths = append(paths, LocalModuleDirs(absProject)...)
+	}
+	sourceRoot := commonAncestor(paths)
+	if sourceRoot == "" {
+		return nil, fmt.Errorf("no projects to copy")
+	}
+
+	dir, err := os.MkdirTemp(parent, "tfdrift-*")
+	if err != nil {
+		return nil, err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Workspace{SourceRoot: sourceRoot, Dir: dir}
+	log.Infof("[NewWorkspace] Copying %s to %s", sourceRoot, w.copyRoot())
+	if err := copyTree(sourceRoot, w.copyRoot(), dir); err != nil {
+		w.Remove()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Where SourceRoot lives inside the workspace. The directory name is kept so project names match.
+func (w *Workspace) copyRoot() string {
+	return filepath.Join(w.Dir, filepath.Base(w.SourceRoot))
+}
+
+// Path of a project's copy inside the workspace.
+func (w *Workspace) Path(project string) string {
+	absProject, err := filepath.Abs(project)
+	if err != nil {
+		return project
+	}
+	rel, err := filepath.Rel(w.SourceRoot, absProject)
+	if err != nil {
+		return project
+	}
+	return filepath.Join(w.copyRoot(), rel)
+}
+
+// Delete the scratch directory.
+func (w *Workspace) Remove() error {
+	log.Debugf("[Workspace] DELETING: %s", w.Dir)
+	return os.RemoveAll(w.Dir)
+}
+
+// Lowest directory containing every path.
+func commonAncestor(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	root := filepath.Clean(paths[0])
+	for _, path := range paths[1:] {
+		path = filepath.Clean(path)
+		for root != filepath.Dir(root) && !isWithin(root, path) {
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
+
+// Check whether path is dir or inside it.
+func isWithin(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Copy src to dst, skipping Terraform caches, VCS metadata, saved plans and the scratch directory itself.
+// Symlinks are recreated as symlinks.
+func copyTree(src string, dst string, scratchDir string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (workspaceSkipDirs[d.Name()] || path == scratchDir) {
+			return filepath.SkipDir
+		}
+		if strings.HasSuffix(d.Name(), ".tfplan") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src string, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
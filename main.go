@@ -2,7 +2,15 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 	"tfdrift/app/general"
+	"tfdrift/app/notify"
 	"tfdrift/app/terraform"
 	"tfdrift/log"
 	"time"
@@ -12,66 +20,464 @@ import (
 
 var (
 	// This gets set during the compilation. See below.
-	path         string
-	html         bool
-	backendConfig string
+	version = "dev"
+
+	path             string
+	html             bool
+	htmlFile         string
+	backendConfig    string
 	terraformVersion string
+	concurrency      int
+	mode             string
+	terraformPath    string
+	terraformCache   string
+	initConcurrency  int
+	timeout          time.Duration
+	projectTimeout   time.Duration
+	failOn           string
+	isolate          bool
+	scratchDir       string
+	optionOutput     string
+	outputFile       string
+	markdownLimit    int
+	metricsFile      string
+	pushgatewayURL   string
+	pushgatewayJob   string
+	githubActions    string
+	reportURL        string
+	notifyAlways     bool
+	slackWebhookURL  string
+	slackToken       string
+	slackChannel     string
+	slackAPIURL      string
+	discordWebhook   string
+	teamsWebhook     string
+	alertOn          string
+	alertKeyPrefix   string
+	alertStateFile   string
+	pagerDutyKey     string
+	pagerDutyURL     string
+	opsgenieKey      string
+	opsgenieURL      string
+	issues           string
+	issueRepo        string
+	issueLabels      []string
+	issueAPIURL      string
+	issueToken       string
+	codeOwnersFile   string
+	webhookURL       string
+	webhookSecret    string
+	webhookHeaders   []string
+	webhookRetries   int
+	webhookDeadFile  string
+	smtpHost         string
+	smtpPort         int
+	smtpSecurity     string
+	smtpUsername     string
+	smtpPassword     string
+	emailFrom        string
+	emailTo          []string
+	emailSubject     string
 )
 
-var TerraformContext = context.Background()
+// Report formats accepted by --output.
+var outputFormats = map[string]bool{
+	"stdout":   true,
+	"json":     true,
+	"junit":    true,
+	"sarif":    true,
+	"markdown": true,
+	"csv":      true,
+	"tsv":      true,
+}
+
+func supportedOutputs() string {
+	var names []string
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Write the report in the format selected by --output. stdout is handled by PrettyTable.
+func writeReport(format string, report *terraform.ScanReport, outputFile string) error {
+	switch format {
+	case "json":
+		return terraform.WriteJSONReport(report, outputFile)
+	case "junit":
+		return terraform.WriteJUnitReport(report, outputFile)
+	case "sarif":
+		return terraform.WriteSARIFReport(report, outputFile)
+	case "markdown":
+		return terraform.WriteMarkdownReport(report, outputFile, markdownLimit)
+	case "csv":
+		return terraform.WriteDelimitedReport(report, outputFile, ',')
+	case "tsv":
+		return terraform.WriteDelimitedReport(report, outputFile, '\t')
+	}
+	return nil
+}
+
+// Value of a secret flag, falling back to an environment variable so it stays out of shell history and --help.
+func envDefault(value string, name string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Notifiers enabled by the flags.
+func configuredNotifiers() ([]notify.Notifier, error) {
+	var notifiers []notify.Notifier
+
+	slack := &notify.SlackNotifier{
+		WebhookURL: envDefault(slackWebhookURL, "SLACK_WEBHOOK_URL"),
+		Token:      envDefault(slackToken, "SLACK_BOT_TOKEN"),
+		Channel:    slackChannel,
+		ReportURL:  reportURL,
+		APIURL:     slackAPIURL,
+	}
+	if slack.WebhookURL != "" || slack.Token != "" {
+		if err := slack.Check(); err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, slack)
+	}
+	if webhookURL := envDefault(discordWebhook, "DISCORD_WEBHOOK_URL"); webhookURL != "" {
+		notifiers = append(notifiers, &notify.DiscordNotifier{WebhookURL: webhookURL, ReportURL: reportURL})
+	}
+	if webhookURL := envDefault(teamsWebhook, "TEAMS_WEBHOOK_URL"); webhookURL != "" {
+		notifiers = append(notifiers, &notify.TeamsNotifier{WebhookURL: webhookURL, ReportURL: reportURL})
+	}
+	pagerDuty := envDefault(pagerDutyKey, "PAGERDUTY_ROUTING_KEY")
+	opsgenie := envDefault(opsgenieKey, "OPSGENIE_API_KEY")
+	if pagerDuty != "" || opsgenie != "" {
+		severity, err := notify.ParseAlertSeverity(alertOn)
+		if err != nil {
+			return nil, err
+		}
+		var state *notify.AlertState
+		if alertStateFile != "" {
+			state = &notify.AlertState{Path: alertStateFile}
+		}
+		if pagerDuty != "" {
+			notifiers = append(notifiers, &notify.PagerDutyNotifier{
+				RoutingKey: pagerDuty,
+				Severity:   severity,
+				KeyPrefix:  alertKeyPrefix,
+				ReportURL:  reportURL,
+				URL:        pagerDutyURL,
+				State:      state,
+			})
+		}
+		if opsgenie != "" {
+			notifiers = append(notifiers, &notify.OpsgenieNotifier{
+				APIKey:    opsgenie,
+				Severity:  severity,
+				KeyPrefix: alertKeyPrefix,
+				ReportURL: reportURL,
+				APIURL:    opsgenieURL,
+				State:     state,
+			})
+		}
+	}
+	if webhookURL != "" {
+		if webhookRetries < 0 {
+			return nil, fmt.Errorf("--webhook-retries %d must be 0 or more", webhookRetries)
+		}
+		headers, err := notify.ParseHeaders(webhookHeaders)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, &notify.WebhookNotifier{
+			URL:            webhookURL,
+			Secret:         envDefault(webhookSecret, "TFDRIFT_WEBHOOK_SECRET"),
+			Headers:        headers,
+			Retries:        webhookRetries,
+			Backoff:        time.Second,
+			DeadLetterFile: webhookDeadFile,
+		})
+	}
+	if len(emailTo) > 0 {
+		email := &notify.EmailNotifier{
+			Host:      smtpHost,
+			Port:      smtpPort,
+			Security:  smtpSecurity,
+			Username:  smtpUsername,
+			Password:  envDefault(smtpPassword, "SMTP_PASSWORD"),
+			From:      emailFrom,
+			Subject:   emailSubject,
+			ReportURL: reportURL,
+			Always:    notifyAlways,
+		}
+		for _, value := range emailTo {
+			recipient, err := notify.ParseEmailRecipient(value)
+			if err != nil {
+				return nil, err
+			}
+			email.Recipients = append(email.Recipients, recipient)
+		}
+		if err := email.Check(); err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, email)
+	}
+	if issues != "" {
+		notifier, err := issueNotifier()
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
+// Issue notifier for --issues, with the CI defaults of the chosen tracker.
+func issueNotifier() (*notify.IssueNotifier, error) {
+	notifier := &notify.IssueNotifier{Labels: issueLabels, ReportURL: reportURL}
+	switch issues {
+	case notify.IssuesGitHub:
+		tracker := &notify.GitHubIssues{
+			Repository: envDefault(issueRepo, "GITHUB_REPOSITORY"),
+			Token:      envDefault(issueToken, "GITHUB_TOKEN"),
+			APIURL:     envDefault(issueAPIURL, "GITHUB_API_URL"),
+		}
+		if err := tracker.Check(); err != nil {
+			return nil, err
+		}
+		notifier.Tracker = tracker
+	case notify.IssuesGitLab:
+		tracker := &notify.GitLabIssues{
+			Project: envDefault(issueRepo, "CI_PROJECT_ID"),
+			Token:   envDefault(issueToken, "GITLAB_TOKEN"),
+			APIURL:  envDefault(issueAPIURL, "CI_API_V4_URL"),
+		}
+		if err := tracker.Check(); err != nil {
+			return nil, err
+		}
+		notifier.Tracker = tracker
+	default:
+		return nil, fmt.Errorf("--issues %q not supported (%s, %s)", issues, notify.IssuesGitHub, notify.IssuesGitLab)
+	}
+
+	codeOwnersPath, root := codeOwnersFile, ""
+	switch codeOwnersPath {
+	case "none":
+		return notifier, nil
+	case "":
+		codeOwnersPath, root = notify.FindCodeOwners(path)
+		if codeOwnersPath == "" {
+			log.Debugf("[issueNotifier] No CODEOWNERS file found, issues are opened unassigned")
+			return notifier, nil
+		}
+	default:
+		// Patterns are relative to the repository root, the parent of .github, .gitlab or docs
+		root = filepath.Dir(codeOwnersPath)
+		switch filepath.Base(root) {
+		case ".github", ".gitlab", "docs":
+			root = filepath.Dir(root)
+		}
+	}
+	codeOwners, err := notify.LoadCodeOwners(codeOwnersPath, root)
+	if err != nil {
+		return nil, err
+	}
+	notifier.CodeOwners = codeOwners
+	return notifier, nil
+}
 
 func main() {
 	var scan = &cobra.Command{
 		Use:   "scan",
 		Short: "scan for infrastructure drift",
 		Run: func(cmd *cobra.Command, args []string) {
-			optionOutput := ""
-			cvProjects, cvIsPlannable := general.GetPlannableProjects(path)
+			// Unexpected panics would otherwise exit with 2, which means drift. Scan workers recover their
+			// own and record the project as internal_error.
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("[reportCmd] %v", r)
+					os.Exit(terraform.ExitToolFailure)
+				}
+			}()
+
+			if !outputFormats[optionOutput] {
+				log.Fatalf("[reportCmd] --output %q not supported (%s)", optionOutput, supportedOutputs())
+			}
+			// The table is only printed, a file would silently stay unwritten
+			if optionOutput == "stdout" && outputFile != "" {
+				log.Fatalf("[reportCmd] --output-file needs a file format with --output (json, junit, sarif, markdown, csv or tsv)")
+			}
+			if !terraform.ValidMode(mode) {
+				log.Fatalf("[reportCmd] --mode %q not supported (full, refresh-only, both)", mode)
+			}
+			failPolicy, err := terraform.ParseFailPolicy(failOn)
+			if err != nil {
+				log.Fatalf("[reportCmd] %s", err)
+			}
+			githubEnabled, err := terraform.GitHubActionsEnabled(githubActions)
+			if err != nil {
+				log.Fatalf("[reportCmd] %s", err)
+			}
+			notifiers, err := configuredNotifiers()
+			if err != nil {
+				log.Fatalf("[reportCmd] %s", err)
+			}
+			cvProjects, cvIsPlannable, err := general.GetPlannableProjects(path)
+			if err != nil {
+				log.Fatalf("[reportCmd] Unable to scan %s: %s", path, err)
+			}
 
 			driftDetectTime := time.Now()
 			var terraformServices []*terraform.TerraformService
-			tfChannel := make(chan *terraform.TerraformService)
 
-			//tf drift is adding a batching job because too many concurrencies during terraform init will block some of them from running
-			// https://github.com/hashicorp/terraform/issues/32915
+			// Ctrl-C / SIGTERM cancel the running terraform commands, a second signal exits immediately
+			sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-sigCtx.Done()
+				stop()
+			}()
+			ctx := sigCtx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
 			if cvIsPlannable {
-				batchSize := 5 // Number of goroutines per batch
-				for i := 0; i < len(cvProjects); i += batchSize {
-					for j := i; j < i+batchSize && j < len(cvProjects); j++ {
-						go func(absProjectPath string) {
-							terraform.GetProjectDrift(tfChannel, absProjectPath, backendConfig, terraformVersion)
-						}(cvProjects[j])
-					}
-					time.Sleep(5 * time.Second) // Wait for 2 seconds before starting the next batch
-				}
-				for _, _ = range cvProjects {
-					terraformServices = append(terraformServices, <-tfChannel)
+				terraformServices, err = terraform.ScanProjects(ctx, cvProjects, terraform.ScanOptions{
+					BackendConfig:    backendConfig,
+					TerraformVersion: terraformVersion,
+					DetectVersion:    !cmd.Flags().Changed("terraform-version"),
+					Mode:             mode,
+					Binaries:         terraform.NewBinaryManager(terraformCache, terraformPath),
+					Concurrency:      concurrency,
+					InitConcurrency:  initConcurrency,
+					ProjectTimeout:   projectTimeout,
+					Isolate:          isolate,
+					ScratchDir:       scratchDir,
+				})
+				if err != nil {
+					log.Fatalf("[reportCmd] %s", err)
 				}
 			} else {
 				log.Printf("[reportCmd] No *.tf files found")
 			}
+			report := terraform.NewScanReport(path, version, mode, driftDetectTime, time.Now(), terraformServices)
+
 			// Where is the message going?
-			if optionOutput == "stdout" || optionOutput == "" {
-				log.Debug("[cmdReport] Outputting to Stdout.")
-				if html {
-					terraform.GenerateHTML(terraformServices)
+			if html || cmd.Flags().Changed("html-file") {
+				if err := terraform.GenerateHTML(report, htmlFile); err != nil {
+					log.Fatalf("[reportCmd] Unable to write HTML report: %s", err)
 				}
+			}
+			// The table stays on stdout unless stdout is taken by another format
+			if optionOutput == "stdout" || outputFile != "" {
+				log.Debug("[cmdReport] Outputting to Stdout.")
 				terraform.PrettyTable(terraformServices)
+			}
+			if err := writeReport(optionOutput, report, outputFile); err != nil {
+				log.Fatalf("[reportCmd] Unable to write %s report: %s", optionOutput, err)
+			}
 
-				// Drift Report
-				log.Printf("[reportCmd] Drift report took %s to report to stdout.\n", time.Since(driftDetectTime))
-			} else {
-				log.Errorf("[cmdReport] optionOutput: [%s] not supported (discord, stdout)", optionOutput)
+			if githubEnabled {
+				if err := terraform.WriteGitHubActions(report, os.Stderr); err != nil {
+					log.Errorf("[reportCmd] Unable to report to GitHub Actions: %s", err)
+				}
+			}
+
+			// Metrics for Prometheus
+			if metricsFile != "" {
+				if err := terraform.WriteMetricsFile(report, metricsFile); err != nil {
+					log.Fatalf("[reportCmd] Unable to write metrics: %s", err)
+				}
 			}
+			if pushgatewayURL != "" {
+				// The scan context may already be cancelled, the push gets its own deadline
+				pushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				if err := terraform.PushMetrics(pushCtx, report, pushgatewayURL, pushgatewayJob); err != nil {
+					log.Errorf("[reportCmd] Unable to push metrics: %s", err)
+				}
+				cancel()
+			}
+
+			// Chat and alerting destinations, they also get their own deadline
+			if len(notifiers) > 0 {
+				notifyCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				notify.Send(notifyCtx, report, notifiers, notifyAlways)
+				cancel()
+			}
+
+			// Drift Report
+			log.Printf("[reportCmd] Drift report took %s to report to %s.\n", time.Since(driftDetectTime), optionOutput)
+
+			exitCode := terraform.ScanExitCode(terraformServices, failPolicy)
+			log.Debugf("[reportCmd] Exiting with code %d", exitCode)
+			os.Exit(exitCode)
 		},
 	}
 
-	var rootCmd = &cobra.Command{Use: "tfdrift"}
+	var rootCmd = &cobra.Command{Use: "tfdrift", Version: version}
 	scan.Flags().StringVar(&path, "path", "", "path to scan")
-	scan.Flags().BoolVar(&html, "html", false, "path to scan")
+	scan.Flags().BoolVar(&html, "html", false, "write an HTML report to --html-file")
+	scan.Flags().StringVar(&htmlFile, "html-file", terraform.DefaultHTMLFile, "path of the HTML report (implies --html)")
+	scan.Flags().StringVar(&optionOutput, "output", "stdout", "report format: stdout (table), json, junit, sarif, markdown, csv or tsv")
+	scan.Flags().StringVar(&outputFile, "output-file", "", "write the --output report to this file instead of stdout, not supported with --output stdout")
+	scan.Flags().IntVar(&markdownLimit, "markdown-limit", terraform.DefaultMarkdownLimit, "maximum size in bytes of the markdown report, plans are truncated to fit (0 for no limit)")
+	scan.Flags().StringVar(&metricsFile, "metrics-file", "", "write Prometheus metrics to this file, e.g. a node_exporter textfile collector path")
+	scan.Flags().StringVar(&pushgatewayURL, "pushgateway-url", os.Getenv("TFDRIFT_PUSHGATEWAY_URL"), "push Prometheus metrics to this Pushgateway (env TFDRIFT_PUSHGATEWAY_URL)")
+	scan.Flags().StringVar(&pushgatewayJob, "pushgateway-job", "tfdrift", "job label of the pushed metrics")
+	scan.Flags().StringVar(&githubActions, "github-actions", terraform.GitHubAuto, "annotations, job summary and step outputs for GitHub Actions: auto (when GITHUB_ACTIONS=true), always or never")
+	scan.Flags().StringVar(&reportURL, "report-url", notify.DefaultReportURL(), "link to the report shown in notifications (default: the GitHub Actions run or GitLab job)")
+	scan.Flags().BoolVar(&notifyAlways, "notify-always", false, "send notifications even when there is no drift and no project error")
+	scan.Flags().StringVar(&slackWebhookURL, "slack-webhook-url", "", "post a summary to this Slack incoming webhook (env SLACK_WEBHOOK_URL)")
+	scan.Flags().StringVar(&slackToken, "slack-token", "", "Slack bot token used with --slack-channel (env SLACK_BOT_TOKEN)")
+	scan.Flags().StringVar(&slackChannel, "slack-channel", "", "Slack channel to post to with --slack-token")
+	scan.Flags().StringVar(&slackAPIURL, "slack-api-url", notify.DefaultSlackAPIURL, "Slack Web API base URL used with --slack-token")
+	scan.Flags().StringVar(&discordWebhook, "discord-webhook-url", "", "post one embed per drifted project to this Discord webhook (env DISCORD_WEBHOOK_URL)")
+	scan.Flags().StringVar(&teamsWebhook, "teams-webhook-url", "", "post an Adaptive Card to this Microsoft Teams incoming webhook (env TEAMS_WEBHOOK_URL)")
+	scan.Flags().StringVar(&alertOn, "alert-on", notify.AlertOnDestroy, "drift that raises a PagerDuty or Opsgenie alert: drift (any change) or destroy")
+	scan.Flags().StringVar(&alertKeyPrefix, "alert-key-prefix", notify.DefaultAlertKeyPrefix, "prefix of the per-project alert dedup key, \"<prefix>:<project path>\"")
+	scan.Flags().StringVar(&alertStateFile, "alert-state-file", "", "JSON file recording open alerts between scans, so only those are resolved instead of every clean project")
+	scan.Flags().StringVar(&pagerDutyKey, "pagerduty-routing-key", "", "trigger and resolve PagerDuty incidents with this Events API v2 routing key (env PAGERDUTY_ROUTING_KEY)")
+	scan.Flags().StringVar(&pagerDutyURL, "pagerduty-url", notify.DefaultPagerDutyURL, "PagerDuty Events API v2 endpoint")
+	scan.Flags().StringVar(&opsgenieKey, "opsgenie-api-key", "", "create and close Opsgenie alerts with this API key (env OPSGENIE_API_KEY)")
+	scan.Flags().StringVar(&opsgenieURL, "opsgenie-api-url", notify.DefaultOpsgenieAPIURL, "Opsgenie API base URL, https://api.eu.opsgenie.com for EU accounts")
+	scan.Flags().StringVar(&issues, "issues", "", "keep one issue open per drifted project in this tracker: github or gitlab")
+	scan.Flags().StringVar(&issueRepo, "issue-repo", "", "GitHub repository (owner/name) or GitLab project (ID or path) of the issues (default: GITHUB_REPOSITORY or CI_PROJECT_ID)")
+	scan.Flags().StringSliceVar(&issueLabels, "issue-labels", notify.DefaultIssueLabels, "labels of drift issues, issues are only matched among those having every label")
+	scan.Flags().StringVar(&issueAPIURL, "issue-api-url", "", "REST API base URL of the tracker (default: GITHUB_API_URL or CI_API_V4_URL, then the public API)")
+	scan.Flags().StringVar(&issueToken, "issue-token", "", "token allowed to write issues (env GITHUB_TOKEN or GITLAB_TOKEN)")
+	scan.Flags().StringVar(&codeOwnersFile, "codeowners", "", "CODEOWNERS file assignees are taken from, none to leave issues unassigned (default: found in the repository of --path)")
+	scan.Flags().StringVar(&webhookURL, "webhook-url", "", "POST the JSON report to this URL after every scan")
+	scan.Flags().StringVar(&webhookSecret, "webhook-secret", "", "sign webhook requests with HMAC-SHA256 in the X-Tfdrift-Signature-256 header (env TFDRIFT_WEBHOOK_SECRET)")
+	scan.Flags().StringArrayVar(&webhookHeaders, "webhook-header", nil, "extra webhook request header \"Name: value\" (repeatable)")
+	scan.Flags().IntVar(&webhookRetries, "webhook-retries", 4, "webhook retries after a network error, 429 or 5xx response, with exponential backoff")
+	scan.Flags().StringVar(&webhookDeadFile, "webhook-dead-letter", "", "append the report to this file when webhook delivery fails")
+	scan.Flags().StringArrayVar(&emailTo, "email-to", nil, "email the report to these comma separated addresses, optionally only for projects under paths: \"a@example.com=network/,dns\" (repeatable)")
+	scan.Flags().StringVar(&emailFrom, "email-from", "tfdrift@localhost", "sender address of report emails")
+	scan.Flags().StringVar(&emailSubject, "email-subject", "[tfdrift]", "subject prefix of report emails")
+	scan.Flags().StringVar(&smtpHost, "smtp-host", "", "SMTP server used by --email-to")
+	scan.Flags().IntVar(&smtpPort, "smtp-port", 587, "SMTP server port")
+	scan.Flags().StringVar(&smtpSecurity, "smtp-security", notify.SMTPStartTLS, "SMTP connection security: starttls, tls or none")
+	scan.Flags().StringVar(&smtpUsername, "smtp-username", "", "SMTP username")
+	scan.Flags().StringVar(&smtpPassword, "smtp-password", "", "SMTP password (env SMTP_PASSWORD)")
 	scan.Flags().StringVar(&backendConfig, "backend-config", "", "backend configuration file")
-	scan.Flags().StringVar(&terraformVersion, "terraform-version", "1.7.0", "terraform version to use")
+	scan.Flags().StringVar(&terraformVersion, "terraform-version", "1.7.0", "terraform version to use for every project (default: detected per project, falling back to 1.7.0)")
+	scan.Flags().StringVar(&terraformPath, "terraform-path", "", "terraform binary to use instead of downloading one, a path or a name on PATH")
+	scan.Flags().StringVar(&terraformCache, "terraform-cache-dir", terraform.DefaultCacheDir(), "directory where downloaded terraform releases are cached")
+	scan.Flags().StringVar(&mode, "mode", terraform.ModeFull, "plan mode: full, refresh-only (changes outside terraform only) or both")
+	scan.Flags().IntVar(&concurrency, "concurrency", 5, "number of projects to scan at the same time")
+	scan.Flags().IntVar(&initConcurrency, "init-concurrency", 2, "number of terraform init runs allowed at the same time")
+	scan.Flags().DurationVar(&timeout, "timeout", 0, "maximum duration of the whole scan, e.g. 30m (0 = no limit)")
+	scan.Flags().BoolVar(&isolate, "isolate", false, "run init and plan in a scratch copy so the scanned tree is never modified")
+	scan.Flags().StringVar(&scratchDir, "scratch-dir", "", "parent directory for the --isolate scratch copy (default: system temp directory)")
+	scan.Flags().StringVar(&failOn, "fail-on", "drift,error", "comma separated outcomes that make the scan exit non-zero: drift, error, destroy, none")
+	scan.Flags().DurationVar(&projectTimeout, "project-timeout", 0, "maximum duration of a single project, e.g. 10m (0 = no limit)")
 
 	rootCmd.AddCommand(scan)
-	rootCmd.Execute()
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(terraform.ExitToolFailure)
+	}
 }